@@ -1,12 +1,13 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
 // 	protoc-gen-go v1.36.6
-// 	protoc        v3.12.4
+// 	protoc        (unknown)
 // source: service.proto
 
 package client
 
 import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
@@ -669,7 +670,7 @@ var File_service_proto protoreflect.FileDescriptor
 
 const file_service_proto_rawDesc = "" +
 	"\n" +
-	"\rservice.proto\x12\x04grpc\"E\n" +
+	"\rservice.proto\x12\x04grpc\x1a\x1cgoogle/api/annotations.proto\"E\n" +
 	"\n" +
 	"AppRequest\x12\x15\n" +
 	"\x06org_id\x18\x01 \x01(\tR\x05orgId\x12 \n" +
@@ -716,19 +717,19 @@ const file_service_proto_rawDesc = "" +
 	"\x14ExchangeTokenRequest\x12!\n" +
 	"\faccess_token\x18\x01 \x01(\tR\vaccessToken\x12#\n" +
 	"\rrefresh_token\x18\x02 \x01(\tR\frefreshToken\x12\x15\n" +
-	"\x06app_id\x18\x03 \x01(\tR\x05appId2\xda\x04\n" +
-	"\vAuthService\x128\n" +
-	"\tUserToken\x12\x16.grpc.UserTokenRequest\x1a\x13.grpc.TokenResponse\x12>\n" +
+	"\x06app_id\x18\x03 \x01(\tR\x05appId2\xf9\x05\n" +
+	"\vAuthService\x12T\n" +
+	"\tUserToken\x12\x16.grpc.UserTokenRequest\x1a\x13.grpc.TokenResponse\"\x1a\x82\xd3\xe4\x93\x02\x14:\x01*\"\x0f/v1/users/token\x12>\n" +
 	"\fServiceToken\x12\x19.grpc.ServiceTokenRequest\x1a\x13.grpc.TokenResponse\x12@\n" +
-	"\rExchangeToken\x12\x1a.grpc.ExchangeTokenRequest\x1a\x13.grpc.TokenResponse\x123\n" +
+	"\rExchangeToken\x12\x1a.grpc.ExchangeTokenRequest\x1a\x13.grpc.TokenResponse\x12I\n" +
 	"\n" +
-	"CreateUser\x12\x11.grpc.UserRequest\x1a\x12.grpc.UserResponse\x123\n" +
+	"CreateUser\x12\x11.grpc.UserRequest\x1a\x12.grpc.UserResponse\"\x14\x82\xd3\xe4\x93\x02\x0e:\x01*\"\t/v1/users\x123\n" +
 	"\n" +
-	"UpdateUser\x12\x11.grpc.UserRequest\x1a\x12.grpc.UserResponse\x12?\n" +
-	"\x0eCreateAppGroup\x12\x15.grpc.AppGroupRequest\x1a\x16.grpc.AppGroupResponse\x12?\n" +
-	"\x0eUpdateAppGroup\x12\x15.grpc.AppGroupRequest\x1a\x16.grpc.AppGroupResponse\x12?\n" +
-	"\vGetAppGroup\x12\x18.grpc.GetAppGroupRequest\x1a\x16.grpc.AppGroupResponse\x120\n" +
-	"\tCreateApp\x12\x10.grpc.AppRequest\x1a\x11.grpc.AppResponse\x120\n" +
+	"UpdateUser\x12\x11.grpc.UserRequest\x1a\x12.grpc.UserResponse\x12Z\n" +
+	"\x0eCreateAppGroup\x12\x15.grpc.AppGroupRequest\x1a\x16.grpc.AppGroupResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/v1/app-groups\x12_\n" +
+	"\x0eUpdateAppGroup\x12\x15.grpc.AppGroupRequest\x1a\x16.grpc.AppGroupResponse\"\x1e\x82\xd3\xe4\x93\x02\x18:\x01*\x1a\x13/v1/app-groups/{id}\x12\\\n" +
+	"\vGetAppGroup\x12\x18.grpc.GetAppGroupRequest\x1a\x16.grpc.AppGroupResponse\"\x1b\x82\xd3\xe4\x93\x02\x15\x12\x13/v1/app-groups/{id}\x12E\n" +
+	"\tCreateApp\x12\x10.grpc.AppRequest\x1a\x11.grpc.AppResponse\"\x13\x82\xd3\xe4\x93\x02\r:\x01*\"\b/v1/apps\x120\n" +
 	"\tUpdateApp\x12\x10.grpc.AppRequest\x1a\x11.grpc.AppResponseB0Z.github.com/zero-shubham/authsvc/transport/grpcb\x06proto3"
 
 var (
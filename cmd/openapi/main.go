@@ -0,0 +1,66 @@
+// Command openapi prints the OpenAPI document the plugin serves for a
+// configuration, so that CI can diff it against the committed contract.
+//
+//	go run ./cmd/openapi -config plugin.json -o openapi.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON file with the plugin keys, the default routes are used when empty")
+	out := flag.String("o", "", "file the document is written to, stdout when empty")
+	flag.Parse()
+
+	if err := run(*configPath, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "openapi:", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath, out string) error {
+	raw := map[string]interface{}{}
+	if configPath != "" {
+		b, err := os.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("unable to parse %s: %w", configPath, err)
+		}
+	}
+	// the document does not depend on the backend address
+	if _, ok := raw["host"]; !ok {
+		raw["host"] = "localhost:50051"
+	}
+	cfg, err := wrapper.ParseConfig(raw)
+	if err != nil {
+		return err
+	}
+
+	routes, _, err := wrapper.ResolveRoutes(cfg)
+	if err != nil {
+		return err
+	}
+	doc, err := wrapper.OpenAPI(routes, client.File_service_proto.Services().ByName("AuthService"))
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(out, b, 0o644)
+}
@@ -4,16 +4,18 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
-	"github.com/luraproject/lura/v2/config"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/zero-shubham/surveyx-apigw/client"
 	"github.com/zero-shubham/surveyx-apigw/wrapper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const pluginName = "krakend-grpc-proxy"
@@ -25,6 +27,13 @@ type registerer string
 
 var logger Logger = nil
 
+// metricsRegistry outlives the reloads, so that metrics are not reset by them.
+var metricsRegistry = prometheus.NewRegistry()
+
+// routeStores outlive the reloads too, so that the responses kept by the
+// routes are not dropped by them.
+var routeStores = wrapper.NewRouteStores()
+
 func (registerer) RegisterLogger(v interface{}) {
 	l, ok := v.(Logger)
 	if !ok {
@@ -43,65 +52,321 @@ func (r registerer) RegisterClients(f func(
 
 // go build -buildmode=plugin -o krakend-client-example.so .
 func (r registerer) registerClients(ctx context.Context, extra map[string]interface{}) (http.Handler, error) {
-	// Access global configuration from context
-	cfg, err := config.NewParser().Parse("/etc/krakend/krakend.json")
+	raw, ok := extra[pluginName].(map[string]interface{})
+	if !ok && extra[pluginName] != nil {
+		return nil, fmt.Errorf("%s: unable to parse the configuration: expected an object, got %T", pluginName, extra[pluginName])
+	}
+	if logger == nil {
+		// KrakenD did not register its logger
+		logger = wrapper.NewSlogLogger(slog.Default())
+	}
+	cfg, err := wrapper.ParseConfig(raw)
 	if err != nil {
-		return nil, errors.New("unable to parse the configuration")
+		return nil, fmt.Errorf("%s: unable to parse the configuration: %w", pluginName, err)
 	}
-	var host string
-	if proxyCfg, ok := cfg.ExtraConfig[pluginName]; ok {
-		if proxyCfgParsed, parsed := proxyCfg.(map[string]interface{}); parsed {
-			if h, done := proxyCfgParsed["host"].(string); done {
-				host = h
-			}
+
+	// the discovered services outlive the reloads, to fall back on them, and
+	// are refreshed by a single loop for every generation of the routes
+	discovery := wrapper.NewDiscovery(logger, func(host string) (*grpc.ClientConn, error) {
+		return grpc.NewClient(host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	})
+	if _, err := discovery.Discover(ctx, cfg); err != nil {
+		logger.Warning("service discovery failed, serving the configured routes only: ", err)
+	}
+	reloader, err := wrapper.NewReloader(logger, func(cfg wrapper.Config) (http.Handler, func(), error) {
+		return build(ctx, cfg, discovery)
+	}, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", pluginName, err)
+	}
+	go reloader.Watch(ctx, raw, cfg)
+	go discovery.Refresh(ctx, reloader.Config)
+	go reloader.RebuildOn(ctx, discovery.Changed())
+
+	// return the actual handler wrapping or your custom logic so it can be used as a replacement for the default http handler
+	return reloader, nil
+}
+
+// build dials the backend, with extra added to the dial options, and wires
+// the routes of cfg with the services last found by discovery. The returned
+// release func stops the connection monitor and closes the connection.
+func build(ctx context.Context, cfg wrapper.Config, discovery *wrapper.Discovery, extra ...grpc.DialOption) (http.Handler, func(), error) {
+	redactor := wrapper.NewRedactor(cfg.Redaction)
+	logger := wrapper.RedactLogger(logger, redactor)
+	logger.Info("host: ", cfg.Host)
+
+	resolved, unmatched, err := wrapper.ResolveRoutes(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, route := range unmatched {
+		logger.Warning("no google.api.http annotation for route, ignoring it: ", route.Method, " ", route.Endpoint)
+	}
+	cfg.Routes = resolved
+
+	bc := backoff.DefaultConfig
+	bc.BaseDelay = time.Duration(cfg.ReconnectBaseDelay)
+	bc.MaxDelay = time.Duration(cfg.ReconnectMaxDelay)
+
+	// Set up a connection to the server. grpc connects lazily, so this only
+	// fails on a malformed target and an unreachable backend is handled by the monitor.
+	stats := wrapper.StatsHandler{}
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: bc}),
+	}, cfg.Connection.DialOptions()...)
+	dialOpts = append(dialOpts, extra...)
+
+	var traceRoute func(endpoint, rpc string) wrapper.Middleware
+	shutdownTracing := func() {}
+	if cfg.Tracing != nil {
+		tp, err := wrapper.NewTracerProvider(ctx, *cfg.Tracing, redactor)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to set up tracing: %w", err)
 		}
+		shutdownTracing = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = tp.Shutdown(ctx)
+		}
+		tracing := wrapper.NewTracing(tp)
+		traceRoute = tracing.Middleware
+		// first in the chain, so that the span covers the whole call
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor))
+	}
+
+	var (
+		measureRoute  func(endpoint string) wrapper.Middleware
+		measureCalls  grpc.UnaryClientInterceptor
+		countHedge    func(method string)
+		metricsParams []wrapper.WrapperParam
+	)
+	if cfg.Metrics != nil {
+		reg, gatherer := prometheus.Registerer(metricsRegistry), prometheus.Gatherer(metricsRegistry)
+		if cfg.Metrics.Registry == "default" {
+			reg, gatherer = prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+		}
+		metrics, err := wrapper.NewMetrics(*cfg.Metrics, reg, gatherer)
+		if err != nil {
+			shutdownTracing()
+			return nil, nil, err
+		}
+		measureRoute, measureCalls, countHedge, metricsParams = metrics.Middleware, metrics.UnaryClientInterceptor, metrics.Hedged, metrics.Params()
+	}
+
+	var (
+		recordRoute func(endpoint, rpc string) wrapper.Middleware
+		debugParams []wrapper.WrapperParam
+	)
+	if cfg.Debug != nil {
+		recorder := wrapper.NewDebugRecorder(*cfg.Debug, redactor)
+		recordRoute, debugParams = recorder.Middleware, recorder.Params()
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(recorder.UnaryClientInterceptor))
+	}
+
+	coalescer := wrapper.NewCoalescer()
+	dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(wrapper.LogUnaryClientInterceptor, wrapper.StaleUnaryClientInterceptor, wrapper.SlowUnaryClientInterceptor, coalescer.UnaryClientInterceptor))
+	stats["coalesce"] = func() interface{} { return coalescer.Stats() }
+	if cfg.AdaptiveLimit != nil {
+		limiter := wrapper.NewAdaptiveLimiter(*cfg.AdaptiveLimit)
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(limiter.UnaryClientInterceptor))
+		stats["adaptive_limit"] = func() interface{} { return limiter.Stats() }
+	}
+	if measureCalls != nil {
+		// last in the chain, so that only the calls reaching the backend are measured
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(measureCalls))
 	}
 
-	logger.Info("host: ", host)
-	// Set up a connection to the server.
-	conn, err := grpc.NewClient(host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	pool, err := wrapper.DialPool(cfg.Host, cfg.Connection.PoolSize, dialOpts...)
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		shutdownTracing()
+		return nil, nil, fmt.Errorf("unable to create client for host %q: %w", cfg.Host, err)
 	}
-	go func() {
-		<-ctx.Done()
-		conn.Close()
-	}()
 
-	grpcClient := client.NewAuthServiceClient(conn)
+	ctx, cancel := context.WithCancel(ctx)
+	release := func() {
+		cancel()
+		pool.Close()
+		shutdownTracing()
+	}
 
-	client := wrapper.NewWrapperClient(grpcClient, logger)
-	wrapper := wrapper.NewGRPCwrapper(logger, wrapper.WrapperParam{
-		Endpoint: "/v1/users/token",
-		Handler:  client.HandleUserToken,
-		Method:   "POST",
-	}, wrapper.WrapperParam{
-		Endpoint: "/v1/users",
-		Handler:  client.HandleCreateUser,
-		Method:   "POST",
-	}, wrapper.WrapperParam{
-		Endpoint: "/v1/apps",
-		Handler:  client.HandleCreateApp,
-		Method:   "POST",
-	}, wrapper.WrapperParam{
-		Endpoint: "/v1/app-groups",
-		Handler:  client.HandleCreateAppGroup,
-		Method:   "POST",
-	}, wrapper.WrapperParam{
-		Endpoint: "/v1/app-groups",
-		Handler:  client.HandleGetAppGroup,
-		Method:   "GET",
+	conns := make([]wrapper.MonitoredConn, 0, len(pool.Conns()))
+	for _, conn := range pool.Conns() {
+		conns = append(conns, conn)
+	}
+	monitor := wrapper.NewConnMonitor(logger, "auth", bc, conns...)
+	go monitor.Run(ctx)
+
+	hedger := wrapper.NewHedger(pool, countHedge)
+	stats["hedge"] = func() interface{} { return hedger.Stats() }
+	grpcClient := client.NewAuthServiceClient(hedger)
+
+	if cfg.Discovery != nil {
+		if found := discovery.Last(); found != nil {
+			discovered, err := wrapper.ServiceRoutes(found.Files, found.Services)
+			if err != nil {
+				release()
+				return nil, nil, fmt.Errorf("unable to route the discovered services: %w", err)
+			}
+			cfg.Routes = wrapper.WithServiceRoutes(cfg.Routes, discovered)
+		}
+	}
+
+	health := wrapper.NewHealthHandler(logger, time.Duration(cfg.HealthCheckTimeout), wrapper.Backend{
+		Name:   "auth",
+		Conn:   pool,
+		Health: grpc_health_v1.NewHealthClient(pool),
 	})
 
-	// return the actual handler wrapping or your custom logic so it can be used as a replacement for the default http handler
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	bulkheads := make(map[string]wrapper.Middleware, len(cfg.Bulkheads))
+	bulkheadStats := make(map[string]func() wrapper.BulkheadStats, len(cfg.Bulkheads))
+	for name, bulkheadCfg := range cfg.Bulkheads {
+		b := wrapper.NewBulkhead(logger, name, bulkheadCfg)
+		bulkheads[name] = b.Middleware
+		bulkheadStats[name] = b.Stats
+	}
+	stats["bulkheads"] = func() interface{} {
+		snapshot := make(map[string]wrapper.BulkheadStats, len(bulkheadStats))
+		for name, f := range bulkheadStats {
+			snapshot[name] = f()
+		}
+		return snapshot
+	}
+
+	caches := make(map[string]wrapper.Middleware)
+	invalidators := make(map[string]wrapper.Middleware)
+	cacheStats := make(map[string]func() wrapper.CacheStats)
+	for _, route := range cfg.Routes {
+		if route.Cache == nil {
+			continue
+		}
+		c := wrapper.NewResponseCache(logger, *route.Cache, routeStores.Cache(route.Endpoint, route.Cache.MaxEntries))
+		caches[route.Endpoint] = c.Middleware
+		invalidators[route.Endpoint] = c.Invalidate
+		cacheStats[route.Endpoint] = c.Stats
+	}
+	stats["cache"] = func() interface{} {
+		snapshot := make(map[string]wrapper.CacheStats, len(cacheStats))
+		for endpoint, f := range cacheStats {
+			snapshot[endpoint] = f()
+		}
+		return snapshot
+	}
+
+	stales := make(map[string]wrapper.Middleware)
+	staleStats := make(map[string]func() wrapper.StaleStats)
+	for _, route := range cfg.Routes {
+		if route.StaleIfError == nil {
+			continue
+		}
+		s := wrapper.NewStaleCache(logger, *route.StaleIfError, routeStores.Stale(route.Endpoint, route.StaleIfError.MaxEntries))
+		stales[route.Endpoint] = s.Middleware
+		staleStats[route.Endpoint] = s.Stats
+	}
+	stats["stale_if_error"] = func() interface{} {
+		snapshot := make(map[string]wrapper.StaleStats, len(staleStats))
+		for endpoint, f := range staleStats {
+			snapshot[endpoint] = f()
+		}
+		return snapshot
+	}
+
+	openAPI, err := wrapper.OpenAPI(cfg.Routes, client.File_service_proto.Services().ByName("AuthService"))
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	client := wrapper.NewWrapperClient(grpcClient, logger)
+	handlers := client.Handlers()
+	transcoder := wrapper.NewTranscoder(logger, hedger, cfg.Connection.MaxSendMsgSize)
+	routes := make([]wrapper.WrapperParam, 0, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		handler, ok := handlers[route.RPC]
+		if route.HTTPRule != nil {
+			handler, ok = transcoder.Handler(route.HTTPRule), true
+		}
+		if !ok {
+			release()
+			return nil, nil, &wrapper.ConfigError{Key: fmt.Sprintf("routes[%d].rpc", i), Err: fmt.Errorf("no handler for rpc %q", route.RPC)}
+		}
+		// inside the cache and stale middlewares, so that they still answer
+		// while the backend is unreachable
+		handler = monitor.Middleware(handler)
+		if route.Coalesce != nil {
+			handler = coalescer.Middleware(*route.Coalesce)(handler)
+		}
+		if route.Hedge != nil {
+			handler = hedger.Middleware(*route.Hedge)(handler)
+		}
+		if route.Cache != nil {
+			handler = caches[route.Endpoint](handler)
+		} else if invalidate, ok := invalidators[route.Endpoint]; ok {
+			handler = invalidate(handler)
+		}
+		if route.StaleIfError != nil {
+			handler = stales[route.Endpoint](handler)
+		}
+		if route.Idempotency != nil {
+			handler = wrapper.NewIdempotency(logger, *route.Idempotency, routeStores.Idempotency(route.Endpoint)).Middleware(handler)
+		}
+		if route.Bulkhead != "" {
+			handler = bulkheads[route.Bulkhead](handler)
+		}
+		routes = append(routes, wrapper.WrapperParam{
+			Endpoint: route.Endpoint,
+			Handler:  handler,
+			Method:   route.Method,
+		})
+	}
+
+	params := append(health.Params(), stats.Params()...)
+	for i, route := range cfg.Routes {
+		if route.SlowThreshold > 0 {
+			routes[i].Handler = wrapper.SlowRequests(logger, time.Duration(route.SlowThreshold))(routes[i].Handler)
+		}
+		if recordRoute != nil {
+			routes[i].Handler = recordRoute(route.Endpoint, route.RPC)(routes[i].Handler)
+		}
+		routes[i].Handler = wrapper.LogRoute(route.Endpoint, route.RPC)(routes[i].Handler)
+		if measureRoute != nil {
+			routes[i].Handler = measureRoute(route.Endpoint)(routes[i].Handler)
+		}
+		if traceRoute != nil {
+			routes[i].Handler = traceRoute(route.Endpoint, route.RPC)(routes[i].Handler)
+		}
+	}
+	params = append(params, metricsParams...)
+	params = append(params, debugParams...)
+	params = append(params, routes...)
+	if cfg.OpenAPIPath != "" {
+		params = append(params, wrapper.OpenAPIParams(cfg.OpenAPIPath, openAPI)...)
+	}
+	router := wrapper.NewGRPCwrapper(logger, params...)
+
+	handler := func(w http.ResponseWriter, req *http.Request) {
 
 		// grpc.NewAuthServiceClient().UserToken()
-		logger.Debug(fmt.Sprintf("req path: %v %s", req.URL, req.RequestURI))
+		wrapper.RequestLogger(req.Context(), logger).Debug("req path: ", req.URL, " ", req.RequestURI)
 
-		wrapper.GetHandler(req.URL.Path, req.Method)(w, req)
+		router.ServeHTTP(w, req)
+
+	}
+	if cfg.AccessLog != nil {
+		accessLog, err := wrapper.NewAccessLog(logger, *cfg.AccessLog)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		handler = accessLog.Middleware(handler)
+		releaseBackend := release
+		release = func() {
+			releaseBackend()
+			accessLog.Close()
+		}
+	}
 
-	}), nil
+	return wrapper.RequestID(handler), release, nil
 }
 
 func main() {}
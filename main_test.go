@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// authServer answers the app group and user RPCs with fixed messages.
+type authServer struct {
+	client.UnimplementedAuthServiceServer
+}
+
+func (authServer) GetAppGroup(_ context.Context, req *client.GetAppGroupRequest) (*client.AppGroupResponse, error) {
+	return &client.AppGroupResponse{Id: req.GetId(), Name: "admins"}, nil
+}
+
+func (authServer) CreateUser(_ context.Context, req *client.UserRequest) (*client.UserResponse, error) {
+	return &client.UserResponse{Email: req.GetEmail()}, nil
+}
+
+// bufconnBackend serves srv and returns the dial option reaching it, and
+// the server to stop it.
+func bufconnBackend(t *testing.T, srv client.AuthServiceServer) (grpc.DialOption, *grpc.Server) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	client.RegisterAuthServiceServer(server, srv)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }), server
+}
+
+func init() {
+	logger = wrapper.NewSlogLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestBuild(t *testing.T) {
+	cfg, err := wrapper.ParseConfig(map[string]interface{}{"host": "passthrough:///bufnet"})
+	require.NoError(t, err)
+
+	backend, _ := bufconnBackend(t, authServer{})
+	handler, release, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+	require.NoError(t, err)
+	defer release()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("should serve the api routes", func(t *testing.T) {
+		w := serve(http.MethodGet, "/v1/app-groups/g1", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"g1"`)
+		assert.Contains(t, w.Body.String(), `"admins"`)
+
+		w = serve(http.MethodPost, "/v1/users", `{"email":"a@b.c","password":"secret"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"a@b.c"`)
+	})
+
+	t.Run("should serve the internal routes", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/__health", "").Code)
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/v1/openapi.json", "").Code)
+	})
+}
+
+func TestBuildAnnotations(t *testing.T) {
+	cfg, err := wrapper.ParseConfig(map[string]interface{}{
+		"host":         "passthrough:///bufnet",
+		"route_source": "annotations",
+	})
+	require.NoError(t, err)
+
+	backend, _ := bufconnBackend(t, authServer{})
+	handler, release, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+	require.NoError(t, err)
+	defer release()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups/g1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"g1"`)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"email":"a@b.c"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"a@b.c"`)
+}
+
+func TestBuildDiscovery(t *testing.T) {
+	cfg, err := wrapper.ParseConfig(map[string]interface{}{
+		"host":      "passthrough:///bufnet",
+		"discovery": map[string]interface{}{},
+	})
+	require.NoError(t, err)
+
+	// build only reads the last known services, the discovery has no way to
+	// reach a backend
+	backend, _ := bufconnBackend(t, authServer{})
+	handler, release, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+	require.NoError(t, err)
+	defer release()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups/g1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBuildIdempotency(t *testing.T) {
+	cfg, err := wrapper.ParseConfig(map[string]interface{}{
+		"host": "passthrough:///bufnet",
+		"routes": []interface{}{
+			map[string]interface{}{"endpoint": "/v1/users", "method": "POST", "rpc": "CreateUser", "idempotency": map[string]interface{}{}},
+		},
+	})
+	require.NoError(t, err)
+	backend, _ := bufconnBackend(t, authServer{})
+
+	post := func() *httptest.ResponseRecorder {
+		handler, release, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+		require.NoError(t, err)
+		defer release()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"email":"a@b.c"}`))
+		req.Header.Set("Idempotency-Key", "key-1")
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusOK, post().Code)
+
+	// the retry is served by another generation of the routes
+	w := post()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestBuildBackendDown(t *testing.T) {
+	cfg, err := wrapper.ParseConfig(map[string]interface{}{
+		"host":                 "passthrough:///bufnet",
+		"reconnect_base_delay": "10ms",
+		"reconnect_max_delay":  "50ms",
+		"routes": []interface{}{
+			map[string]interface{}{"endpoint": "/v1/app-groups/{id}", "method": "GET", "rpc": "GetAppGroup", "stale_if_error": map[string]interface{}{}},
+			map[string]interface{}{"endpoint": "/v1/users", "method": "POST", "rpc": "CreateUser"},
+		},
+	})
+	require.NoError(t, err)
+
+	backend, server := bufconnBackend(t, authServer{})
+	handler, release, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+	require.NoError(t, err)
+	defer release()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/v1/app-groups/g1", "").Code)
+
+	server.Stop()
+	// the monitor answers 503 with Retry-After once every connection is down
+	require.Eventually(t, func() bool {
+		w := serve(http.MethodPost, "/v1/users", `{"email":"a@b.c"}`)
+		return w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != ""
+	}, 5*time.Second, 20*time.Millisecond)
+
+	w := serve(http.MethodGet, "/v1/app-groups/g1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Contains(t, w.Body.String(), `"admins"`)
+
+	t.Run("should keep the stale responses across rebuilds", func(t *testing.T) {
+		rebuilt, releaseRebuilt, err := build(context.Background(), cfg, wrapper.NewDiscovery(logger, nil), backend)
+		require.NoError(t, err)
+		defer releaseRebuilt()
+
+		w := httptest.NewRecorder()
+		rebuilt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups/g1", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	})
+}
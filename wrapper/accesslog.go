@@ -0,0 +1,290 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogConfig writes a line per request served by the routes.
+type AccessLogConfig struct {
+	// Format is "json" or "clf", the Common Log Format followed by the duration, rpc, grpc code and request ID.
+	Format string `json:"format"`
+	// File is the path the lines are appended to, empty to write them to the plugin logger.
+	File string `json:"file"`
+	// MaxSize is the size in MiB after which File is rotated.
+	MaxSize int `json:"max_size"`
+	// MaxBackups is the number of rotated files kept, as File.1 to File.N.
+	MaxBackups int `json:"max_backups"`
+	// Sample maps route endpoints to the share of their successful requests
+	// that are logged, failed requests are always logged.
+	Sample map[string]float64 `json:"sample"`
+}
+
+func (c *AccessLogConfig) setDefaults() {
+	*c = AccessLogConfig{
+		Format:     "json",
+		MaxSize:    100,
+		MaxBackups: 5,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c AccessLogConfig) Validate(key string) error {
+	if c.Format != "json" && c.Format != "clf" {
+		return &ConfigError{Key: joinKey(key, "format"), Err: fmt.Errorf("unsupported format %q", c.Format)}
+	}
+	if c.MaxSize < 1 {
+		return &ConfigError{Key: joinKey(key, "max_size"), Err: errors.New("must be at least 1")}
+	}
+	if c.MaxBackups < 0 {
+		return &ConfigError{Key: joinKey(key, "max_backups"), Err: errors.New("must not be negative")}
+	}
+	for endpoint, ratio := range c.Sample {
+		if ratio < 0 || ratio > 1 {
+			return &ConfigError{Key: joinKey(joinKey(key, "sample"), endpoint), Err: errors.New("must be between 0 and 1")}
+		}
+	}
+	return nil
+}
+
+// accessLogEntry is a line of the access log.
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	RPC       string    `json:"rpc,omitempty"`
+	GRPCCode  string    `json:"grpc_code,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	Proto     string    `json:"-"`
+}
+
+type accessLog struct {
+	cfg    AccessLogConfig
+	logger Logger
+	file   *rotatingFile
+	close  sync.Once
+}
+
+// NewAccessLog writes the access log to logger, or to cfg.File when set.
+// The access logs of a same file share it, so that the generations of a hot
+// reload append to it and rotate it together. Close the access log to
+// release its file.
+func NewAccessLog(logger Logger, cfg AccessLogConfig) (*accessLog, error) {
+	a := &accessLog{cfg: cfg, logger: logger}
+	if cfg.File != "" {
+		f, err := accessLogFiles.open(cfg.File, int64(cfg.MaxSize)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open access log: %w", err)
+		}
+		a.file = f
+	}
+	return a, nil
+}
+
+// Middleware logs the requests of the routes, it must run within RequestID
+// for the route, rpc and request ID to be known. Internal /__ routes are
+// not logged.
+func (a *accessLog) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/__") {
+			next(respWtr, req)
+			return
+		}
+		start := time.Now()
+		w := &statusWriter{ResponseWriter: respWtr}
+		next(w, req)
+
+		entry := accessLogEntry{
+			Time:     start,
+			Method:   req.Method,
+			Status:   w.Status(),
+			Bytes:    w.size,
+			Duration: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP: clientIP(req),
+			Proto:    req.Proto,
+		}
+		if f := logFieldsFrom(req.Context()); f != nil {
+			f.mu.Lock()
+			entry.Route, entry.RPC, entry.GRPCCode, entry.RequestID = f.route, f.rpc, f.grpcCode, f.requestID
+			f.mu.Unlock()
+		}
+		if ratio, ok := a.cfg.Sample[entry.Route]; ok && entry.Status < 400 && rand.Float64() >= ratio {
+			return
+		}
+		a.write(entry)
+	}
+}
+
+func (a *accessLog) write(entry accessLogEntry) {
+	var line string
+	if a.cfg.Format == "clf" {
+		line = fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %d %.3f %s %s %s`,
+			entry.ClientIP, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method, orDash(entry.Route), entry.Proto, entry.Status, entry.Bytes,
+			entry.Duration, orDash(entry.RPC), orDash(entry.GRPCCode), orDash(entry.RequestID))
+	} else {
+		b, _ := json.Marshal(entry)
+		line = string(b)
+	}
+
+	if a.file == nil {
+		a.logger.Info(line)
+		return
+	}
+	if _, err := io.WriteString(a.file, line+"\n"); err != nil {
+		a.logger.Error("unable to write access log: ", err)
+	}
+}
+
+// Close releases the access log file, if any, closing it once no access log
+// uses it anymore.
+func (a *accessLog) Close() error {
+	var err error
+	a.close.Do(func() {
+		if a.file != nil {
+			err = accessLogFiles.release(a.file)
+		}
+	})
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sharedFiles are the open access log files, by path.
+type sharedFiles struct {
+	mu    sync.Mutex
+	files map[string]*rotatingFile
+}
+
+var accessLogFiles = &sharedFiles{files: make(map[string]*rotatingFile)}
+
+// open returns the file at path, opening it unless another access log did.
+// maxSize and backups apply to the shared file from then on.
+func (s *sharedFiles) open(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.files[path]; ok {
+		r.mu.Lock()
+		r.maxSize, r.backups = maxSize, backups
+		r.mu.Unlock()
+		r.refs++
+		return r, nil
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups, refs: 1}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	s.files[path] = r
+	return r, nil
+}
+
+// release closes r once released by every access log using it.
+func (s *sharedFiles) release(r *rotatingFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.refs--; r.refs > 0 {
+		return nil
+	}
+	delete(s.files, r.path)
+	return r.Close()
+}
+
+// rotatingFile appends to a file, renamed to path.1 once it reaches maxSize
+// while the previous backups shift up to path.<backups>.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+	// refs counts the access logs using the file, guarded by the sharedFiles
+	refs int
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.file == nil || r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		if rotateErr = r.rotate(); rotateErr != nil && r.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := r.file.Write(b)
+	r.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("unable to rotate %s, kept appending to it: %w", r.path, rotateErr)
+	}
+	return n, err
+}
+
+// rotate moves the file to path.1 and opens a new one. When the file cannot
+// be moved, it is opened again as it is, so that the lines keep being
+// appended past maxSize rather than lost. r.file is nil when no file could
+// be opened.
+func (r *rotatingFile) rotate() error {
+	_ = r.file.Close()
+	r.file = nil
+	err := r.shift()
+	if openErr := r.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shift moves the file and its backups up by one, dropping the oldest.
+func (r *rotatingFile) shift() error {
+	if r.backups == 0 {
+		if err := os.Remove(r.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	for i := r.backups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(r.path, r.path+".1")
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
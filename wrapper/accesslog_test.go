@@ -0,0 +1,138 @@
+package wrapper_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAccessLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+
+	// serve runs a request through the middlewares the plugin puts around a route
+	serve := func(accessLog wrapper.Middleware, endpoint, path string, status int) {
+		route := wrapper.LogRoute(endpoint, "GetAppGroup")(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"id":"appgrp123"}`))
+		})
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		wrapper.RequestID(accessLog(route))(httptest.NewRecorder(), req)
+	}
+
+	t.Run("should write json lines to the logger", func(t *testing.T) {
+		var line string
+		mockedLogger.EXPECT().Info(gomock.Any()).Do(func(v ...interface{}) { line = v[0].(string) })
+
+		a, err := wrapper.NewAccessLog(mockedLogger, wrapper.AccessLogConfig{Format: "json", MaxSize: 1})
+		require.NoError(t, err)
+		serve(a.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "GET", entry["method"])
+		assert.Equal(t, "/v1/app-groups/{id}", entry["route"])
+		assert.Equal(t, float64(http.StatusOK), entry["status"])
+		assert.Equal(t, float64(18), entry["bytes"])
+		assert.Equal(t, "GetAppGroup", entry["rpc"])
+		assert.Equal(t, "req-1", entry["request_id"])
+		assert.Contains(t, entry, "duration_ms")
+		assert.Contains(t, entry, "time")
+	})
+
+	t.Run("should write clf lines to a rotated file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		a, err := wrapper.NewAccessLog(mockedLogger, wrapper.AccessLogConfig{Format: "clf", File: path, MaxSize: 1, MaxBackups: 1})
+		require.NoError(t, err)
+		defer a.Close()
+
+		serve(a.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusNotFound)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Regexp(t, `^192\.0\.2\.1 - - \[[^\]]+\] "GET /v1/app-groups/\{id\} HTTP/1\.1" 404 18 [0-9.]+ GetAppGroup - req-1\n$`, string(b))
+
+		// a line over the size limit rotates the file
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 1<<20)), 0o644))
+		a.Close()
+		a, err = wrapper.NewAccessLog(mockedLogger, wrapper.AccessLogConfig{Format: "clf", File: path, MaxSize: 1, MaxBackups: 1})
+		require.NoError(t, err)
+		serve(a.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+
+		rotated, err := os.Stat(path + ".1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1<<20), rotated.Size())
+		b, err = os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	})
+
+	t.Run("should keep writing when the file cannot be rotated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 1<<20)), 0o644))
+		// a non empty directory cannot be replaced by the file
+		require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755))
+		a, err := wrapper.NewAccessLog(mockedLogger, wrapper.AccessLogConfig{Format: "clf", File: path, MaxSize: 1, MaxBackups: 1})
+		require.NoError(t, err)
+		defer a.Close()
+
+		mockedLogger.EXPECT().Error("unable to write access log: ", gomock.Any())
+		serve(a.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1<<20, strings.Index(string(b), "192.0.2.1"))
+	})
+
+	t.Run("should share the file across reloads", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 1<<20)), 0o644))
+		cfg := wrapper.AccessLogConfig{Format: "clf", File: path, MaxSize: 1, MaxBackups: 1}
+		draining, err := wrapper.NewAccessLog(mockedLogger, cfg)
+		require.NoError(t, err)
+		current, err := wrapper.NewAccessLog(mockedLogger, cfg)
+		require.NoError(t, err)
+		defer current.Close()
+
+		// the rotation by the current access log moves the draining one to
+		// the new file too
+		serve(current.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+		serve(draining.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+		require.NoError(t, draining.Close())
+		serve(current.Middleware, "/v1/app-groups/{id}", "/v1/app-groups/appgrp123", http.StatusOK)
+
+		rotated, err := os.Stat(path + ".1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1<<20), rotated.Size())
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 3, strings.Count(string(b), "\n"))
+	})
+
+	t.Run("should sample successful requests only", func(t *testing.T) {
+		a, err := wrapper.NewAccessLog(mockedLogger, wrapper.AccessLogConfig{
+			Format:  "json",
+			MaxSize: 1,
+			Sample:  map[string]float64{"/v1/users/token": 0},
+		})
+		require.NoError(t, err)
+
+		mockedLogger.EXPECT().Info(gomock.Any()).Times(1)
+		serve(a.Middleware, "/v1/users/token", "/v1/users/token", http.StatusOK)
+		serve(a.Middleware, "/v1/users/token", "/v1/users/token", http.StatusUnauthorized)
+		serve(a.Middleware, "/__health", "/__health", http.StatusOK)
+	})
+}
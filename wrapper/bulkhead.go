@@ -0,0 +1,121 @@
+package wrapper
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// BulkheadConfig bounds the requests a group of routes may run at once.
+type BulkheadConfig struct {
+	// MaxInFlight is the number of requests served concurrently.
+	MaxInFlight int `json:"max_in_flight"`
+	// MaxQueue is the number of requests allowed to wait for a slot, 0 rejects
+	// as soon as all slots are taken.
+	MaxQueue int `json:"max_queue"`
+	// QueueTimeout is the longest a request waits for a slot.
+	QueueTimeout Duration `json:"queue_timeout"`
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c BulkheadConfig) Validate(key string) error {
+	if c.MaxInFlight < 1 {
+		return &ConfigError{Key: joinKey(key, "max_in_flight"), Err: errors.New("must be at least 1")}
+	}
+	if c.MaxQueue < 0 {
+		return &ConfigError{Key: joinKey(key, "max_queue"), Err: errors.New("must not be negative")}
+	}
+	if c.MaxQueue > 0 && c.QueueTimeout <= 0 {
+		return &ConfigError{Key: joinKey(key, "queue_timeout"), Err: errors.New("must be positive when max_queue is set")}
+	}
+	return nil
+}
+
+// BulkheadStats is a snapshot of a bulkhead.
+type BulkheadStats struct {
+	InFlight    int64  `json:"in_flight"`
+	Queued      int64  `json:"queued"`
+	MaxInFlight int    `json:"max_in_flight"`
+	MaxQueue    int    `json:"max_queue"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+type bulkhead struct {
+	name     string
+	cfg      BulkheadConfig
+	slots    chan struct{}
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	rejected atomic.Uint64
+	logger   Logger
+}
+
+// NewBulkhead isolates the routes sharing it, so a spike on one group cannot
+// starve the others.
+func NewBulkhead(logger Logger, name string, cfg BulkheadConfig) *bulkhead {
+	return &bulkhead{
+		name:   name,
+		cfg:    cfg,
+		slots:  make(chan struct{}, cfg.MaxInFlight),
+		logger: logger,
+	}
+}
+
+// Middleware runs next once a slot is free, and answers 503 when the queue is
+// full or the request waited longer than the queue timeout.
+func (b *bulkhead) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		if !b.acquire(req) {
+			b.rejected.Add(1)
+			RequestLogger(req.Context(), b.logger).Warning("bulkhead full, rejecting request: ", b.name, " ", req.URL.Path)
+			respWtr.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer b.release()
+		next(respWtr, req)
+	}
+}
+
+func (b *bulkhead) acquire(req *http.Request) bool {
+	select {
+	case b.slots <- struct{}{}:
+		b.inFlight.Add(1)
+		return true
+	default:
+	}
+
+	if b.queued.Add(1) > int64(b.cfg.MaxQueue) {
+		b.queued.Add(-1)
+		return false
+	}
+	defer b.queued.Add(-1)
+
+	timer := time.NewTimer(time.Duration(b.cfg.QueueTimeout))
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		b.inFlight.Add(1)
+		return true
+	case <-timer.C:
+		return false
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+func (b *bulkhead) release() {
+	b.inFlight.Add(-1)
+	<-b.slots
+}
+
+// Stats returns the current occupancy of the bulkhead.
+func (b *bulkhead) Stats() BulkheadStats {
+	return BulkheadStats{
+		InFlight:    b.inFlight.Load(),
+		Queued:      b.queued.Load(),
+		MaxInFlight: b.cfg.MaxInFlight,
+		MaxQueue:    b.cfg.MaxQueue,
+		Rejected:    b.rejected.Load(),
+	}
+}
@@ -0,0 +1,75 @@
+package wrapper_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBulkhead(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Warning("bulkhead full, rejecting request: ", "token", " ", "/v1/users/token").AnyTimes()
+
+	b := wrapper.NewBulkhead(mockedLogger, "token", wrapper.BulkheadConfig{
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: wrapper.Duration(100 * time.Millisecond),
+	})
+
+	unblock := make(chan struct{})
+	handler := b.Middleware(func(w http.ResponseWriter, _ *http.Request) {
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func() <-chan int {
+		code := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/v1/users/token", nil))
+			code <- w.Code
+		}()
+		return code
+	}
+
+	t.Run("should queue then reject when the queue is full", func(t *testing.T) {
+		first := serve()
+		require.Eventually(t, func() bool { return b.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+		second := serve()
+		require.Eventually(t, func() bool { return b.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+		assert.Equal(t, http.StatusServiceUnavailable, <-serve())
+
+		close(unblock)
+		assert.Equal(t, http.StatusOK, <-first)
+		assert.Equal(t, http.StatusOK, <-second)
+
+		stats := b.Stats()
+		assert.Equal(t, int64(0), stats.InFlight)
+		assert.Equal(t, int64(0), stats.Queued)
+		assert.Equal(t, uint64(1), stats.Rejected)
+	})
+
+	t.Run("should reject requests waiting longer than the queue timeout", func(t *testing.T) {
+		unblock = make(chan struct{})
+		first := serve()
+		require.Eventually(t, func() bool { return b.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+
+		start := time.Now()
+		assert.Equal(t, http.StatusServiceUnavailable, <-serve())
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+		close(unblock)
+		assert.Equal(t, http.StatusOK, <-first)
+	})
+}
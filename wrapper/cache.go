@@ -0,0 +1,323 @@
+package wrapper
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheConfig enables the response cache on a GET route.
+type CacheConfig struct {
+	// TTL is how long a response is served from the cache.
+	TTL Duration `json:"ttl"`
+	// MaxEntries bounds the cached responses, the least recently used are evicted first.
+	MaxEntries int `json:"max_entries"`
+	// Headers are the request headers added to the cache key, so that
+	// responses for different tenants or users are never mixed. Authorization
+	// is always part of the key.
+	Headers []string `json:"headers"`
+}
+
+func (c *CacheConfig) setDefaults() {
+	*c = CacheConfig{
+		TTL:        Duration(time.Minute),
+		MaxEntries: 1000,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c CacheConfig) Validate(key string) error {
+	if c.TTL <= 0 {
+		return &ConfigError{Key: joinKey(key, "ttl"), Err: errors.New("must be positive")}
+	}
+	if c.MaxEntries < 1 {
+		return &ConfigError{Key: joinKey(key, "max_entries"), Err: errors.New("must be at least 1")}
+	}
+	return nil
+}
+
+// CachedResponse is a response kept by a CacheStore.
+type CachedResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+	Expires  time.Time
+	// Tag groups the variants of a resource so they can be invalidated together.
+	Tag string
+}
+
+// CacheStore keeps cached responses. The in-memory LRU store is used by
+// default, a shared store can implement this interface instead.
+type CacheStore interface {
+	Get(key string) (CachedResponse, bool)
+	Set(key string, resp CachedResponse)
+	// DeleteTag removes every response stored with tag.
+	DeleteTag(tag string)
+	Len() int
+}
+
+type lruEntry struct {
+	key  string
+	resp CachedResponse
+}
+
+type lruStore struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{}
+}
+
+// NewLRUStore keeps at most max responses in memory.
+func NewLRUStore(max int) CacheStore {
+	return &lruStore{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *lruStore) Get(key string) (CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.resp.Expires) {
+		s.remove(el)
+		return CachedResponse{}, false
+	}
+	s.order.MoveToFront(el)
+	return entry.resp, true
+}
+
+func (s *lruStore) Set(key string, resp CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, resp: resp})
+	if s.tags[resp.Tag] == nil {
+		s.tags[resp.Tag] = make(map[string]struct{})
+	}
+	s.tags[resp.Tag][key] = struct{}{}
+
+	for s.order.Len() > s.max {
+		s.remove(s.order.Back())
+	}
+}
+
+func (s *lruStore) DeleteTag(tag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.tags[tag] {
+		s.remove(s.entries[key])
+	}
+}
+
+func (s *lruStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *lruStore) remove(el *list.Element) {
+	entry := s.order.Remove(el).(*lruEntry)
+	delete(s.entries, entry.key)
+	delete(s.tags[entry.resp.Tag], entry.key)
+	if len(s.tags[entry.resp.Tag]) == 0 {
+		delete(s.tags, entry.resp.Tag)
+	}
+}
+
+// RouteStores keeps the stores of the routes across reloads, so that
+// rebuilding the routes does not drop what they stored. A store is replaced
+// when the size configured for its route changes.
+type RouteStores struct {
+	mu     sync.Mutex
+	stores map[string]keptStore
+}
+
+type keptStore struct {
+	size  int
+	store any
+}
+
+// NewRouteStores returns an empty set of stores, created as routes ask for them.
+func NewRouteStores() *RouteStores {
+	return &RouteStores{stores: make(map[string]keptStore)}
+}
+
+// get returns the store kept under key, created by newStore when there is
+// none of that size yet.
+func (s *RouteStores) get(key string, size int, newStore func() any) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if kept, ok := s.stores[key]; ok && kept.size == size {
+		return kept.store
+	}
+	store := newStore()
+	s.stores[key] = keptStore{size: size, store: store}
+	return store
+}
+
+// Cache returns the LRU store of the response cache of endpoint.
+func (s *RouteStores) Cache(endpoint string, maxEntries int) CacheStore {
+	return s.get("cache "+endpoint, maxEntries, func() any { return NewLRUStore(maxEntries) }).(CacheStore)
+}
+
+// CacheStats counts the lookups of a route cache.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+type responseCache struct {
+	cfg     CacheConfig
+	store   CacheStore
+	headers []string
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+	logger  Logger
+}
+
+// NewResponseCache caches the successful responses of a GET route in store.
+func NewResponseCache(logger Logger, cfg CacheConfig, store CacheStore) *responseCache {
+	return &responseCache{
+		cfg:     cfg,
+		store:   store,
+		headers: keyHeaders(cfg.Headers),
+		logger:  logger,
+	}
+}
+
+// Middleware serves GET requests from the cache and stores the 200 responses
+// of the others. Requests with Cache-Control: no-cache skip the lookup but
+// still refresh the entry.
+func (c *responseCache) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		key := requestKey(req, c.headers)
+		if !strings.Contains(req.Header.Get("Cache-Control"), "no-cache") {
+			if cached, ok := c.store.Get(key); ok {
+				c.hits.Add(1)
+				writeCached(respWtr, req, cached, "HIT")
+				return
+			}
+		}
+		c.misses.Add(1)
+
+		capture := newResponseCapture(respWtr)
+		capture.onHeader = func(status int, header http.Header) {
+			header.Set("X-Cache", "MISS")
+			if status == http.StatusOK {
+				header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(time.Duration(c.cfg.TTL).Seconds())))
+				header.Set("Age", "0")
+			}
+		}
+		next(capture, req)
+
+		if capture.Status() != http.StatusOK {
+			return
+		}
+		now := time.Now()
+		c.store.Set(key, CachedResponse{
+			Status:   capture.Status(),
+			Header:   capture.header,
+			Body:     capture.body.Bytes(),
+			StoredAt: now,
+			Expires:  now.Add(time.Duration(c.cfg.TTL)),
+			Tag:      cacheTag(req),
+		})
+	}
+}
+
+// Invalidate drops the cached responses of the request path once an unsafe
+// request on it succeeded, so that an update is never followed by a stale read.
+func (c *responseCache) Invalidate(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		capture := newResponseCapture(respWtr)
+		next(capture, req)
+		if capture.Status() >= 200 && capture.Status() < 300 {
+			RequestLogger(req.Context(), c.logger).Debug("invalidating cached responses of ", req.URL.Path)
+			c.store.DeleteTag(cacheTag(req))
+		}
+	}
+}
+
+// requestKey identifies the response to a request by its path, query and the
+// values of headers.
+func requestKey(req *http.Request, headers []string) string {
+	var key strings.Builder
+	key.WriteString(cacheTag(req))
+	key.WriteByte('?')
+	key.WriteString(req.URL.RawQuery)
+	for _, h := range headers {
+		key.WriteByte(0)
+		key.WriteString(strings.Join(req.Header.Values(h), ","))
+	}
+	return key.String()
+}
+
+// keyHeaders canonicalizes names and adds Authorization, so that the
+// responses of different callers are never shared.
+func keyHeaders(names []string) []string {
+	headers := canonicalHeaders(names)
+	if !slices.Contains(headers, "Authorization") {
+		headers = append(headers, "Authorization")
+	}
+	return headers
+}
+
+func canonicalHeaders(names []string) []string {
+	headers := make([]string, 0, len(names))
+	for _, h := range names {
+		headers = append(headers, http.CanonicalHeaderKey(h))
+	}
+	return headers
+}
+
+// cacheTag identifies the resource a request is about, regardless of method and query.
+func cacheTag(req *http.Request) string {
+	return strings.TrimSuffix(req.URL.Path, "/")
+}
+
+// Stats returns the hits, misses and size of the cache.
+func (c *responseCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.store.Len(),
+	}
+}
+
+// writeCached answers with a stored response, or 304 when it matches the
+// request If-None-Match.
+func writeCached(respWtr http.ResponseWriter, req *http.Request, cached CachedResponse, xCache string) {
+	for k, vs := range cached.Header {
+		respWtr.Header()[k] = append([]string(nil), vs...)
+	}
+	age := time.Since(cached.StoredAt)
+	remaining := time.Until(cached.Expires)
+	respWtr.Header().Set("Age", fmt.Sprint(int(age.Seconds())))
+	respWtr.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(max(remaining, 0).Seconds())))
+	respWtr.Header().Set("X-Cache", xCache)
+	if etagMatches(req.Header.Get("If-None-Match"), cached.Header.Get("ETag"), true) {
+		respWtr.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respWtr.WriteHeader(cached.Status)
+	_, _ = respWtr.Write(cached.Body)
+}
@@ -0,0 +1,162 @@
+package wrapper_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestResponseCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Debug(gomock.Any()).AnyTimes()
+
+	var backendCalls int
+	backend := func(w http.ResponseWriter, req *http.Request) {
+		backendCalls++
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == http.MethodGet && req.URL.Path == "/v1/app-groups/missing" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"id":"appgrp123"}`))
+	}
+
+	newCache := func(cfg wrapper.CacheConfig) (http.HandlerFunc, http.HandlerFunc) {
+		c := wrapper.NewResponseCache(mockedLogger, cfg, wrapper.NewLRUStore(cfg.MaxEntries))
+		return c.Middleware(backend), c.Invalidate(backend)
+	}
+
+	get := func(h http.HandlerFunc, path, tenant string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		h(w, req)
+		return w
+	}
+
+	cfg := wrapper.CacheConfig{TTL: wrapper.Duration(time.Minute), MaxEntries: 10, Headers: []string{"x-tenant-id"}}
+
+	t.Run("should serve repeated reads from the cache", func(t *testing.T) {
+		backendCalls = 0
+		cached, _ := newCache(cfg)
+
+		first := get(cached, "/v1/app-groups/appgrp123", "tenant-a")
+		assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+		assert.Equal(t, "private, max-age=60", first.Header().Get("Cache-Control"))
+
+		second := get(cached, "/v1/app-groups/appgrp123", "tenant-a")
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, "HIT", second.Header().Get("X-Cache"))
+		assert.Equal(t, "0", second.Header().Get("Age"))
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"id":"appgrp123"}`, second.Body.String())
+		assert.Equal(t, 1, backendCalls)
+	})
+
+	t.Run("should not share responses between callers", func(t *testing.T) {
+		backendCalls = 0
+		cached, _ := newCache(wrapper.CacheConfig{TTL: wrapper.Duration(time.Minute), MaxEntries: 10})
+		getAs := func(token string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			cached(w, req)
+			return w
+		}
+
+		assert.Equal(t, "MISS", getAs("token-a").Header().Get("X-Cache"))
+		assert.Equal(t, "MISS", getAs("token-b").Header().Get("X-Cache"))
+		assert.Equal(t, "HIT", getAs("token-a").Header().Get("X-Cache"))
+		assert.Equal(t, 2, backendCalls)
+	})
+
+	t.Run("should answer 304 from the cache when the ETag matches", func(t *testing.T) {
+		cached, _ := newCache(cfg)
+
+		get(cached, "/v1/app-groups/appgrp123", "tenant-a")
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+		req.Header.Set("X-Tenant-ID", "tenant-a")
+		req.Header.Set("If-None-Match", `"v1"`)
+		cached(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("should key entries on the configured headers", func(t *testing.T) {
+		backendCalls = 0
+		cached, _ := newCache(cfg)
+
+		get(cached, "/v1/app-groups/appgrp123", "tenant-a")
+		assert.Equal(t, "MISS", get(cached, "/v1/app-groups/appgrp123", "tenant-b").Header().Get("X-Cache"))
+		assert.Equal(t, 2, backendCalls)
+	})
+
+	t.Run("should not cache failed responses", func(t *testing.T) {
+		backendCalls = 0
+		cached, _ := newCache(cfg)
+
+		w := get(cached, "/v1/app-groups/missing", "tenant-a")
+		assert.Empty(t, w.Header().Get("Cache-Control"))
+		get(cached, "/v1/app-groups/missing", "tenant-a")
+		assert.Equal(t, 2, backendCalls)
+	})
+
+	t.Run("should invalidate every variant on a successful update", func(t *testing.T) {
+		backendCalls = 0
+		cached, invalidating := newCache(cfg)
+
+		get(cached, "/v1/app-groups/appgrp123", "tenant-a")
+		get(cached, "/v1/app-groups/appgrp123", "tenant-b")
+		get(cached, "/v1/app-groups/appgrp456", "tenant-a")
+
+		invalidating(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/v1/app-groups/appgrp123", nil))
+
+		assert.Equal(t, "MISS", get(cached, "/v1/app-groups/appgrp123", "tenant-a").Header().Get("X-Cache"))
+		assert.Equal(t, "MISS", get(cached, "/v1/app-groups/appgrp123", "tenant-b").Header().Get("X-Cache"))
+		assert.Equal(t, "HIT", get(cached, "/v1/app-groups/appgrp456", "tenant-a").Header().Get("X-Cache"))
+	})
+
+	t.Run("should evict least recently used and expired entries", func(t *testing.T) {
+		backendCalls = 0
+		cached, _ := newCache(wrapper.CacheConfig{TTL: wrapper.Duration(50 * time.Millisecond), MaxEntries: 1})
+
+		get(cached, "/v1/app-groups/appgrp123", "")
+		get(cached, "/v1/app-groups/appgrp456", "")
+		assert.Equal(t, "MISS", get(cached, "/v1/app-groups/appgrp123", "").Header().Get("X-Cache"))
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, "MISS", get(cached, "/v1/app-groups/appgrp123", "").Header().Get("X-Cache"))
+		assert.Equal(t, 4, backendCalls)
+	})
+}
+
+func TestRouteStores(t *testing.T) {
+	stores := wrapper.NewRouteStores()
+	store := stores.Cache("/v1/app-groups/{id}", 10)
+	store.Set("key", wrapper.CachedResponse{Status: http.StatusOK, Expires: time.Now().Add(time.Minute)})
+
+	t.Run("should keep the store of a route", func(t *testing.T) {
+		assert.Same(t, store, stores.Cache("/v1/app-groups/{id}", 10))
+		assert.NotSame(t, store, stores.Cache("/v1/apps", 10))
+	})
+
+	t.Run("should replace the store of a resized route", func(t *testing.T) {
+		resized := stores.Cache("/v1/app-groups/{id}", 20)
+		assert.NotSame(t, store, resized)
+		assert.Zero(t, resized.Len())
+	})
+}
@@ -0,0 +1,165 @@
+package wrapper
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// CoalesceConfig opts a route into sharing concurrent identical backend calls.
+type CoalesceConfig struct {
+	// Headers are the forwarded headers added to the coalescing key, so that
+	// calls made for different tenants or users are never shared.
+	// Authorization is always part of the key.
+	Headers []string `json:"headers"`
+}
+
+// CoalesceStats counts the calls seen by the coalescer.
+type CoalesceStats struct {
+	Calls  uint64 `json:"calls"`
+	Shared uint64 `json:"shared"`
+}
+
+type coalesceCtxKey struct{}
+
+// flight is a backend call other identical calls wait for.
+type flight struct {
+	done   chan struct{}
+	reply  proto.Message
+	header metadata.MD
+	err    error
+}
+
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+	calls   atomic.Uint64
+	shared  atomic.Uint64
+}
+
+// NewCoalescer shares the backend calls of the routes using its Middleware,
+// use its UnaryClientInterceptor when dialing the backend.
+func NewCoalescer() *coalescer {
+	return &coalescer{flights: make(map[string]*flight)}
+}
+
+// Middleware marks the requests of a route as eligible for coalescing.
+func (c *coalescer) Middleware(cfg CoalesceConfig) Middleware {
+	headers := make([]string, 0, len(cfg.Headers)+1)
+	for _, h := range cfg.Headers {
+		headers = append(headers, strings.ToLower(h))
+	}
+	if !slices.Contains(headers, "authorization") {
+		headers = append(headers, "authorization")
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			next(respWtr, req.WithContext(context.WithValue(req.Context(), coalesceCtxKey{}, headers)))
+		}
+	}
+}
+
+// UnaryClientInterceptor lets the first of concurrent identical calls reach
+// the backend and hands its reply, response header and error to the others.
+// Calls are identical when their method, request message and selected
+// headers match.
+func (c *coalescer) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	headers, ok := ctx.Value(coalesceCtxKey{}).([]string)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	key, ok := coalesceKey(ctx, method, req, headers)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	c.calls.Add(1)
+
+	c.mu.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+		c.shared.Add(1)
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return f.copyTo(reply, opts)
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	// the waiters must not fail because the first caller went away
+	callCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithDeadline(callCtx, deadline)
+		defer cancel()
+	}
+	f.err = invoker(callCtx, method, req, reply, cc, append(opts, grpc.Header(&f.header))...)
+	if msg, ok := reply.(proto.Message); ok {
+		f.reply = proto.Clone(msg)
+	}
+
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(f.done)
+
+	return f.err
+}
+
+// copyTo fills reply and the header call options of a waiting call.
+func (f *flight) copyTo(reply any, opts []grpc.CallOption) error {
+	if msg, ok := reply.(proto.Message); ok && f.reply != nil {
+		proto.Reset(msg)
+		proto.Merge(msg, f.reply)
+	}
+	f.setHeader(opts)
+	return f.err
+}
+
+func (f *flight) setHeader(opts []grpc.CallOption) {
+	for _, opt := range opts {
+		if h, ok := opt.(grpc.HeaderCallOption); ok {
+			*h.HeaderAddr = f.header.Copy()
+		}
+	}
+}
+
+func coalesceKey(ctx context.Context, method string, req any, headers []string) (string, bool) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(method)
+	key.WriteByte(0)
+	key.Write(b)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, h := range headers {
+		key.WriteByte(0)
+		key.WriteString(strings.Join(md.Get(h), ","))
+	}
+	return key.String(), true
+}
+
+// Stats returns how many calls were eligible and how many shared another one.
+func (c *coalescer) Stats() CoalesceStats {
+	return CoalesceStats{
+		Calls:  c.calls.Load(),
+		Shared: c.shared.Load(),
+	}
+}
@@ -0,0 +1,110 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCoalescer(t *testing.T) {
+	const method = "/grpc.AuthService/GetAppGroup"
+
+	c := wrapper.NewCoalescer()
+
+	var backendCalls atomic.Int32
+	invoker := func(ctx context.Context, _ string, req, reply any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+		backendCalls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		for _, opt := range opts {
+			if h, ok := opt.(grpc.HeaderCallOption); ok {
+				*h.HeaderAddr = metadata.Pairs("x-served-by", "auth-1")
+			}
+		}
+		reply.(*client.AppGroupResponse).Id = req.(*client.GetAppGroupRequest).Id
+		return nil
+	}
+
+	// callAs runs the interceptor the way a coalescing route would, with the
+	// request headers forwarded as outgoing metadata
+	callAs := func(cfg *wrapper.CoalesceConfig, id, tenant, token string) (*client.AppGroupResponse, metadata.MD) {
+		var (
+			reply  client.AppGroupResponse
+			header metadata.MD
+		)
+		handler := func(_ http.ResponseWriter, req *http.Request) {
+			ctx := metadata.AppendToOutgoingContext(req.Context(), "x-tenant-id", tenant, "authorization", "Bearer "+token)
+			err := c.UnaryClientInterceptor(ctx, method, &client.GetAppGroupRequest{Id: id}, &reply, nil, invoker, grpc.Header(&header))
+			assert.NoError(t, err)
+		}
+		if cfg != nil {
+			handler = c.Middleware(*cfg)(handler)
+		}
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/app-groups/"+id, nil))
+		return &reply, header
+	}
+	call := func(cfg *wrapper.CoalesceConfig, id, tenant string) (*client.AppGroupResponse, metadata.MD) {
+		return callAs(cfg, id, tenant, "token-a")
+	}
+
+	concurrently := func(n int, f func(i int)) {
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f(i)
+			}()
+		}
+		wg.Wait()
+	}
+
+	cfg := &wrapper.CoalesceConfig{Headers: []string{"X-Tenant-ID"}}
+
+	t.Run("should share concurrent identical calls", func(t *testing.T) {
+		backendCalls.Store(0)
+		concurrently(5, func(int) {
+			reply, header := call(cfg, "appgrp123", "tenant-a")
+			assert.Equal(t, "appgrp123", reply.Id)
+			assert.Equal(t, []string{"auth-1"}, header.Get("x-served-by"))
+		})
+		assert.Equal(t, int32(1), backendCalls.Load())
+		assert.Equal(t, uint64(4), c.Stats().Shared)
+	})
+
+	t.Run("should not share calls of different tenants or requests", func(t *testing.T) {
+		backendCalls.Store(0)
+		concurrently(4, func(i int) {
+			id := []string{"appgrp123", "appgrp456"}[i%2]
+			tenant := []string{"tenant-a", "tenant-b"}[i/2]
+			reply, _ := call(cfg, id, tenant)
+			assert.Equal(t, id, reply.Id)
+		})
+		assert.Equal(t, int32(4), backendCalls.Load())
+	})
+
+	t.Run("should not share calls of different callers", func(t *testing.T) {
+		backendCalls.Store(0)
+		concurrently(2, func(i int) {
+			callAs(&wrapper.CoalesceConfig{}, "appgrp123", "tenant-a", []string{"token-a", "token-b"}[i])
+		})
+		assert.Equal(t, int32(2), backendCalls.Load())
+	})
+
+	t.Run("should not share calls of routes without coalescing", func(t *testing.T) {
+		backendCalls.Store(0)
+		concurrently(3, func(int) {
+			call(nil, "appgrp123", "tenant-a")
+		})
+		assert.Equal(t, int32(3), backendCalls.Load())
+	})
+}
@@ -1,18 +1,54 @@
 package wrapper
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"os"
+	"reflect"
+	"regexp"
 	"slices"
 	"strings"
+	"time"
 )
 
 var allwedMethods = []string{"POST", "GET", "PATCH", "PUT", "DELETE"}
 
 type wrapper struct {
 	endpointMap map[string]map[string]http.HandlerFunc
+	templates   []routeTemplate
 	logger      Logger
 }
 
+// routeTemplate is an endpoint with {name} segments matching any single path segment.
+type routeTemplate struct {
+	endpoint string
+	segments []string
+}
+
+func (t routeTemplate) match(urlPath string) (map[string]string, bool) {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if len(segments) != len(t.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, seg := range t.segments {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.TrimSuffix(name, "}")] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
 type WrapperParam struct {
 	Endpoint string
 	Method   string
@@ -27,27 +63,575 @@ func NewGRPCwrapper(logger Logger, opts ...WrapperParam) *wrapper {
 
 	for _, opt := range opts {
 		if !slices.Contains(allwedMethods, strings.ToUpper(opt.Method)) {
-			logger.Warning("unexpected method passed, ignoring opt: %v", opt)
+			logger.Warning("unexpected method passed: ", opt.Method, " ", opt.Endpoint)
 		}
 		if _, ok := w.endpointMap[opt.Endpoint]; !ok {
 			w.endpointMap[opt.Endpoint] = make(map[string]http.HandlerFunc, 1)
+			if strings.Contains(opt.Endpoint, "{") {
+				w.templates = append(w.templates, routeTemplate{
+					endpoint: opt.Endpoint,
+					segments: strings.Split(strings.Trim(opt.Endpoint, "/"), "/"),
+				})
+			}
 		}
-		w.endpointMap[opt.Endpoint][opt.Method] = opt.Handler
+		w.endpointMap[opt.Endpoint][strings.ToUpper(opt.Method)] = opt.Handler
 	}
 	return &w
 }
 
+// GetHandler returns the handler registered for urlPath and method. Segments
+// matched by a {name} template are available through req.PathValue(name).
 func (w *wrapper) GetHandler(urlPath, method string) http.HandlerFunc {
+	return w.handler(urlPath, method, w.logger)
+}
+
+// ServeHTTP runs the handler of req, logging the lookup with its request ID.
+func (w *wrapper) ServeHTTP(respWtr http.ResponseWriter, req *http.Request) {
+	w.handler(req.URL.Path, req.Method, RequestLogger(req.Context(), w.logger))(respWtr, req)
+}
+
+func (w *wrapper) handler(urlPath, method string, logger Logger) http.HandlerFunc {
+	var params map[string]string
 	handlers, ok := w.endpointMap[strings.TrimSuffix(urlPath, "/")]
 	if !ok {
-		w.logger.Error("not found handler: ", urlPath)
+		for _, t := range w.templates {
+			if params, ok = t.match(urlPath); ok {
+				handlers = w.endpointMap[t.endpoint]
+				break
+			}
+		}
+	}
+	if !ok {
+		logger.Error("not found handler: ", urlPath)
 		return http.NotFound
 	}
-	w.logger.Info("found handler: ", urlPath)
+	logger.Info("found handler: ", urlPath)
 	methodHandler, ok := handlers[strings.ToUpper(method)]
 	if !ok {
-		w.logger.Error("not found handler for method: ", urlPath, method)
+		logger.Error("not found handler for method: ", urlPath, method)
 		return http.NotFound
 	}
-	return methodHandler
+	if len(params) == 0 {
+		return methodHandler
+	}
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		for name, value := range params {
+			req.SetPathValue(name, value)
+		}
+		methodHandler(respWtr, req)
+	}
+}
+
+// Middleware decorates a route handler.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Use wraps the handler of every param with mws, the first one being the outermost.
+func Use(params []WrapperParam, mws ...Middleware) []WrapperParam {
+	wrapped := make([]WrapperParam, 0, len(params))
+	for _, p := range params {
+		for i := len(mws) - 1; i >= 0; i-- {
+			p.Handler = mws[i](p.Handler)
+		}
+		wrapped = append(wrapped, p)
+	}
+	return wrapped
+}
+
+// Config is the plugin configuration, read from the plugin's own key in the
+// backend extra_config.
+type Config struct {
+	// Host is the grpc target of the auth service.
+	Host string `json:"host"`
+	// HealthCheckTimeout bounds the grpc.health.v1 check behind /__ready.
+	HealthCheckTimeout Duration `json:"health_check_timeout"`
+	// ReconnectBaseDelay and ReconnectMaxDelay bound the backoff between
+	// connection attempts while the backend is unreachable.
+	ReconnectBaseDelay Duration `json:"reconnect_base_delay"`
+	ReconnectMaxDelay  Duration `json:"reconnect_max_delay"`
+	// Connection tunes the grpc connections to the backend.
+	Connection ConnectionConfig `json:"connection"`
+	// Routes pairs endpoints with the RPC serving them.
+	Routes []RouteConfig `json:"routes"`
+	// RouteSource is "config" to serve Routes with the handlers of the plugin,
+	// or "annotations" to derive the routes from the google.api.http
+	// annotations of the RPCs, Routes then only adding options to them.
+	RouteSource string `json:"route_source"`
+	// Descriptors exposes services of a FileDescriptorSet through the
+	// transcoder, nil disables it.
+	Descriptors *DescriptorsConfig `json:"descriptors"`
+	// Discovery exposes the services found through the grpc reflection of the
+	// backend through the transcoder, nil disables it.
+	Discovery *DiscoveryConfig `json:"discovery"`
+	// Bulkheads are named concurrency limits routes opt into.
+	Bulkheads map[string]BulkheadConfig `json:"bulkheads"`
+	// AdaptiveLimit limits the concurrent calls to the backend from their
+	// latency and errors, nil disables it.
+	AdaptiveLimit *AdaptiveLimitConfig `json:"adaptive_limit"`
+	// Tracing exports a span per request and per backend call, nil disables it.
+	Tracing *TracingConfig `json:"tracing"`
+	// Metrics exposes Prometheus metrics of the routes and backend calls, nil disables them.
+	Metrics *MetricsConfig `json:"metrics"`
+	// AccessLog writes a line per request, nil disables it.
+	AccessLog *AccessLogConfig `json:"access_log"`
+	// Redaction extends the policy redacting secrets and personal data from
+	// the logs and traces.
+	Redaction RedactionConfig `json:"redaction"`
+	// Debug records the last requests and serves them, nil disables it.
+	Debug *DebugConfig `json:"debug"`
+	// OpenAPIPath serves the OpenAPI document of the routes, empty disables it.
+	OpenAPIPath string `json:"openapi_path"`
+	// ConfigFile is an optional JSON file with more plugin keys, taking
+	// precedence over the inline ones. It is watched every ReloadInterval and
+	// the plugin swaps its routes and connections whenever it changes.
+	ConfigFile     string   `json:"config_file"`
+	ReloadInterval Duration `json:"reload_interval"`
+	// DrainTimeout bounds how long in-flight requests are awaited before the
+	// connections of a replaced config are closed.
+	DrainTimeout Duration `json:"drain_timeout"`
+}
+
+// RouteConfig binds an endpoint and method to the handler of an RPC.
+type RouteConfig struct {
+	// Endpoint is the path, {name} segments are path params.
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	RPC      string `json:"rpc"`
+	// Bulkhead names the entry of Config.Bulkheads limiting this route,
+	// routes naming the same bulkhead share its limits.
+	Bulkhead string `json:"bulkhead,omitempty"`
+	// Coalesce shares concurrent identical backend calls of this route, nil disables it.
+	Coalesce *CoalesceConfig `json:"coalesce,omitempty"`
+	// Cache keeps the responses of this GET route, nil disables it. Successful
+	// requests with another method on the same endpoint invalidate them.
+	Cache *CacheConfig `json:"cache,omitempty"`
+	// StaleIfError serves the last successful response of this GET route
+	// when the backend is unavailable, nil disables it.
+	StaleIfError *StaleConfig `json:"stale_if_error,omitempty"`
+	// Hedge sends extra attempts of slow backend calls of this read route, nil disables it.
+	Hedge *HedgeConfig `json:"hedge,omitempty"`
+	// Idempotency replays the responses of this POST route to requests
+	// retried with the same Idempotency-Key, nil disables it.
+	Idempotency *IdempotencyConfig `json:"idempotency,omitempty"`
+	// SlowThreshold is the duration after which a request is logged as slow
+	// with a breakdown of its phases, 0 disables it.
+	SlowThreshold Duration `json:"slow_threshold,omitempty"`
+	// HTTPRule binds the route to its RPC when it comes from a google.api.http
+	// annotation, instead of a handler of the plugin.
+	HTTPRule *HTTPRule `json:"-"`
+}
+
+// DefaultRoutes is the route table used when the config has no routes.
+func DefaultRoutes() []RouteConfig {
+	return []RouteConfig{
+		{Endpoint: "/v1/users/token", Method: "POST", RPC: "UserToken"},
+		{Endpoint: "/v1/users", Method: "POST", RPC: "CreateUser"},
+		{Endpoint: "/v1/apps", Method: "POST", RPC: "CreateApp"},
+		{Endpoint: "/v1/app-groups", Method: "POST", RPC: "CreateAppGroup"},
+		{Endpoint: "/v1/app-groups", Method: "GET", RPC: "GetAppGroup"},
+		{Endpoint: "/v1/app-groups/{id}", Method: "GET", RPC: "GetAppGroup"},
+		{Endpoint: "/v1/app-groups/{id}", Method: "PUT", RPC: "UpdateAppGroup"},
+	}
+}
+
+// DefaultConfig returns the configuration used for every key that is not set.
+func DefaultConfig() Config {
+	return Config{
+		HealthCheckTimeout: Duration(2 * time.Second),
+		ReconnectBaseDelay: Duration(time.Second),
+		ReconnectMaxDelay:  Duration(2 * time.Minute),
+		Connection: ConnectionConfig{
+			KeepaliveTimeout: Duration(20 * time.Second),
+			PoolSize:         1,
+		},
+		Routes:         DefaultRoutes(),
+		RouteSource:    "config",
+		OpenAPIPath:    "/v1/openapi.json",
+		ReloadInterval: Duration(5 * time.Second),
+		DrainTimeout:   Duration(30 * time.Second),
+	}
+}
+
+// ConfigError reports a bad value in the plugin configuration.
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config key %q: %v", e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ParseConfig decodes raw, merged with its config_file if any, on top of
+// DefaultConfig. String values may reference environment variables as ${NAME}
+// and files as ${file:/path}, so secrets do not have to live in krakend.json.
+func ParseConfig(raw map[string]interface{}) (Config, error) {
+	cfg := DefaultConfig()
+
+	raw, err := mergeConfigFile(raw)
+	if err != nil {
+		return cfg, err
+	}
+	interpolated, err := interpolate("", raw)
+	if err != nil {
+		return cfg, err
+	}
+	if err := decode("", interpolated, reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func mergeConfigFile(raw map[string]interface{}) (map[string]interface{}, error) {
+	path, _ := raw["config_file"].(string)
+	if path == "" {
+		return raw, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ConfigError{Key: "config_file", Err: err}
+	}
+	var fileRaw map[string]interface{}
+	if err := json.Unmarshal(b, &fileRaw); err != nil {
+		return nil, &ConfigError{Key: "config_file", Err: err}
+	}
+	if _, ok := fileRaw["config_file"]; ok {
+		return nil, &ConfigError{Key: "config_file", Err: errors.New("cannot be set from the config file itself")}
+	}
+
+	merged := maps.Clone(raw)
+	maps.Copy(merged, fileRaw)
+	return merged, nil
+}
+
+// defaulter is implemented by config sections with defaults of their own,
+// applied whenever decode creates the section.
+type defaulter interface {
+	setDefaults()
+}
+
+// newValue returns a settable zero value of t, with its defaults if any.
+func newValue(t reflect.Type) reflect.Value {
+	v := reflect.New(t)
+	if d, ok := v.Interface().(defaulter); ok {
+		d.setDefaults()
+	}
+	return v.Elem()
+}
+
+// decode stores raw into v field by field, so that any error can name the
+// offending key. Keys missing from raw keep the value already in v.
+func decode(key string, raw interface{}, v reflect.Value) error {
+	if raw == nil {
+		return nil
+	}
+	if _, ok := v.Addr().Interface().(json.Unmarshaler); ok {
+		return decodeValue(key, raw, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return &ConfigError{Key: key, Err: fmt.Errorf("expected an object, got %T", raw)}
+		}
+		fields := jsonFields(v.Type())
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			idx, ok := fields[k]
+			if !ok {
+				return &ConfigError{Key: joinKey(key, k), Err: errors.New("unknown key")}
+			}
+			if err := decode(joinKey(key, k), obj[k], v.Field(idx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(newValue(v.Type().Elem()).Addr())
+		}
+		return decode(key, raw, v.Elem())
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return &ConfigError{Key: key, Err: fmt.Errorf("expected a list, got %T", raw)}
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+		for i, item := range items {
+			v.Index(i).Set(newValue(v.Type().Elem()))
+			if err := decode(fmt.Sprintf("%s[%d]", key, i), item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return &ConfigError{Key: key, Err: fmt.Errorf("expected an object, got %T", raw)}
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(obj)))
+		}
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			elem := newValue(v.Type().Elem())
+			if err := decode(joinKey(key, k), obj[k], elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	default:
+		return decodeValue(key, raw, v)
+	}
+}
+
+func decodeValue(key string, raw interface{}, v reflect.Value) error {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return &ConfigError{Key: key, Err: err}
+	}
+	if err := json.Unmarshal(b, v.Addr().Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			err = fmt.Errorf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+		}
+		return &ConfigError{Key: key, Err: err}
+	}
+	return nil
+}
+
+// jsonFields maps the json names of t's fields to their index.
+func jsonFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+// Validate reports the first invalid key.
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return &ConfigError{Key: "host", Err: errors.New("is required")}
+	}
+	if c.HealthCheckTimeout <= 0 {
+		return &ConfigError{Key: "health_check_timeout", Err: errors.New("must be positive")}
+	}
+	if c.ReconnectBaseDelay <= 0 {
+		return &ConfigError{Key: "reconnect_base_delay", Err: errors.New("must be positive")}
+	}
+	if c.ReconnectMaxDelay < c.ReconnectBaseDelay {
+		return &ConfigError{Key: "reconnect_max_delay", Err: errors.New("must not be lower than reconnect_base_delay")}
+	}
+	if err := c.Connection.Validate("connection"); err != nil {
+		return err
+	}
+	if c.RouteSource != "config" && c.RouteSource != "annotations" {
+		return &ConfigError{Key: "route_source", Err: fmt.Errorf("unsupported source %q", c.RouteSource)}
+	}
+	if c.OpenAPIPath != "" && !strings.HasPrefix(c.OpenAPIPath, "/") {
+		return &ConfigError{Key: "openapi_path", Err: errors.New("must start with /")}
+	}
+	if c.ConfigFile != "" && c.ReloadInterval <= 0 {
+		return &ConfigError{Key: "reload_interval", Err: errors.New("must be positive")}
+	}
+	if c.DrainTimeout < 0 {
+		return &ConfigError{Key: "drain_timeout", Err: errors.New("must not be negative")}
+	}
+
+	if c.Descriptors != nil {
+		if err := c.Descriptors.Validate("descriptors"); err != nil {
+			return err
+		}
+	}
+	if c.Discovery != nil {
+		if err := c.Discovery.Validate("discovery"); err != nil {
+			return err
+		}
+	}
+	if c.AdaptiveLimit != nil {
+		if err := c.AdaptiveLimit.Validate("adaptive_limit"); err != nil {
+			return err
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Validate("tracing"); err != nil {
+			return err
+		}
+	}
+	if c.Metrics != nil {
+		if err := c.Metrics.Validate("metrics"); err != nil {
+			return err
+		}
+	}
+	if c.AccessLog != nil {
+		if err := c.AccessLog.Validate("access_log"); err != nil {
+			return err
+		}
+	}
+	if err := c.Redaction.Validate("redaction"); err != nil {
+		return err
+	}
+	if c.Debug != nil {
+		if err := c.Debug.Validate("debug"); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Bulkheads)) {
+		if err := c.Bulkheads[name].Validate(joinKey("bulkheads", name)); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool, len(c.Routes))
+	for i, r := range c.Routes {
+		key := fmt.Sprintf("routes[%d]", i)
+		if !strings.HasPrefix(r.Endpoint, "/") {
+			return &ConfigError{Key: key + ".endpoint", Err: errors.New("must start with /")}
+		}
+		if !slices.Contains(allwedMethods, strings.ToUpper(r.Method)) {
+			return &ConfigError{Key: key + ".method", Err: fmt.Errorf("must be one of %v", allwedMethods)}
+		}
+		if r.RPC == "" {
+			return &ConfigError{Key: key + ".rpc", Err: errors.New("is required")}
+		}
+		if _, ok := c.Bulkheads[r.Bulkhead]; r.Bulkhead != "" && !ok {
+			return &ConfigError{Key: key + ".bulkhead", Err: fmt.Errorf("unknown bulkhead %q", r.Bulkhead)}
+		}
+		if r.Cache != nil {
+			if !strings.EqualFold(r.Method, "GET") {
+				return &ConfigError{Key: key + ".cache", Err: errors.New("only GET routes can be cached")}
+			}
+			if err := r.Cache.Validate(key + ".cache"); err != nil {
+				return err
+			}
+		}
+		if r.StaleIfError != nil {
+			if !strings.EqualFold(r.Method, "GET") {
+				return &ConfigError{Key: key + ".stale_if_error", Err: errors.New("only GET routes can serve stale responses")}
+			}
+			if err := r.StaleIfError.Validate(key + ".stale_if_error"); err != nil {
+				return err
+			}
+		}
+		if r.Hedge != nil {
+			if !strings.EqualFold(r.Method, "GET") {
+				return &ConfigError{Key: key + ".hedge", Err: errors.New("only GET routes can be hedged")}
+			}
+			if c.Connection.PoolSize < 2 {
+				return &ConfigError{Key: key + ".hedge", Err: errors.New("needs a connection.pool_size of at least 2 to reach another subchannel")}
+			}
+			if err := r.Hedge.Validate(key + ".hedge"); err != nil {
+				return err
+			}
+		}
+		if r.Idempotency != nil {
+			if !strings.EqualFold(r.Method, "POST") {
+				return &ConfigError{Key: key + ".idempotency", Err: errors.New("only POST routes can be idempotent")}
+			}
+			if err := r.Idempotency.Validate(key + ".idempotency"); err != nil {
+				return err
+			}
+		}
+		if r.SlowThreshold < 0 {
+			return &ConfigError{Key: key + ".slow_threshold", Err: errors.New("must not be negative")}
+		}
+		route := strings.ToUpper(r.Method) + " " + r.Endpoint
+		if seen[route] {
+			return &ConfigError{Key: key, Err: fmt.Errorf("duplicate route %s", route)}
+		}
+		seen[route] = true
+	}
+	return nil
+}
+
+// placeholder matches ${ref}, and $${ref} which escapes it.
+var placeholder = regexp.MustCompile(`\$?\$\{([^}]+)\}`)
+
+// interpolate resolves placeholders in every string of v, key is the path of v
+// used when reporting errors. $${ref} is kept as the literal ${ref}.
+func interpolate(key string, v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			resolved, err := interpolate(joinKey(key, k), item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			resolved, err := interpolate(fmt.Sprintf("%s[%d]", key, i), item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	case string:
+		var resolveErr error
+		resolved := placeholder.ReplaceAllStringFunc(val, func(m string) string {
+			if strings.HasPrefix(m, "$$") {
+				return m[1:]
+			}
+			ref := placeholder.FindStringSubmatch(m)[1]
+			if path, ok := strings.CutPrefix(ref, "file:"); ok {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					resolveErr = err
+					return ""
+				}
+				return strings.TrimRight(string(content), "\r\n")
+			}
+			env, ok := os.LookupEnv(ref)
+			if !ok {
+				resolveErr = fmt.Errorf("environment variable %s is not set", ref)
+			}
+			return env
+		})
+		if resolveErr != nil {
+			return nil, &ConfigError{Key: key, Err: resolveErr}
+		}
+		return resolved, nil
+	default:
+		return v, nil
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in the config.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("expected a duration string, got %s", b)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
 }
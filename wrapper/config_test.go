@@ -0,0 +1,155 @@
+package wrapper_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("should apply defaults", func(t *testing.T) {
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host": "auth:50051",
+		})
+		require.NoError(t, err)
+
+		expected := wrapper.DefaultConfig()
+		expected.Host = "auth:50051"
+		assert.Equal(t, expected, cfg)
+	})
+
+	t.Run("should override defaults", func(t *testing.T) {
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host":                 "auth:50051",
+			"health_check_timeout": "500ms",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, wrapper.Duration(500*time.Millisecond), cfg.HealthCheckTimeout)
+	})
+
+	t.Run("should interpolate env and file references", func(t *testing.T) {
+		t.Setenv("AUTH_HOST", "auth")
+		secret := filepath.Join(t.TempDir(), "port")
+		require.NoError(t, os.WriteFile(secret, []byte("50051\n"), 0o600))
+
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host": "${AUTH_HOST}:${file:" + secret + "}",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "auth:50051", cfg.Host)
+	})
+
+	t.Run("should keep escaped references", func(t *testing.T) {
+		t.Setenv("AUTH_HOST", "auth")
+
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host": "${AUTH_HOST}-$${SURVEYX_APIGW_UNSET}-$${file:/nowhere}",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "auth-${SURVEYX_APIGW_UNSET}-${file:/nowhere}", cfg.Host)
+	})
+
+	testCases := []struct {
+		name string
+		raw  map[string]interface{}
+		key  string
+	}{
+		{
+			name: "missing host",
+			raw:  nil,
+			key:  "host",
+		},
+		{
+			name: "unknown key",
+			raw:  map[string]interface{}{"host": "auth:50051", "hots": "auth"},
+			key:  "hots",
+		},
+		{
+			name: "wrong type",
+			raw:  map[string]interface{}{"host": 50051},
+			key:  "host",
+		},
+		{
+			name: "invalid duration",
+			raw:  map[string]interface{}{"host": "auth:50051", "reconnect_max_delay": "soon"},
+			key:  "reconnect_max_delay",
+		},
+		{
+			name: "unset env variable",
+			raw:  map[string]interface{}{"host": "${SURVEYX_APIGW_UNSET}"},
+			key:  "host",
+		},
+		{
+			name: "inconsistent backoff",
+			raw:  map[string]interface{}{"host": "auth:50051", "reconnect_base_delay": "1m", "reconnect_max_delay": "1s"},
+			key:  "reconnect_max_delay",
+		},
+		{
+			name: "hedging a single connection",
+			raw: map[string]interface{}{"host": "auth:50051", "routes": []interface{}{
+				map[string]interface{}{"endpoint": "/v1/app-groups/{id}", "method": "GET", "rpc": "GetAppGroup", "hedge": map[string]interface{}{}},
+			}},
+			key: "routes[0].hedge",
+		},
+		{
+			name: "invalid service prefix",
+			raw: map[string]interface{}{"host": "auth:50051", "descriptors": map[string]interface{}{
+				"file":     "services.pb",
+				"services": []interface{}{map[string]interface{}{"name": "survey.SurveyService", "prefix": "v1/surveys/"}},
+			}},
+			key: "descriptors.services[0].prefix",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run("should name the bad key on "+tc.name, func(t *testing.T) {
+			_, err := wrapper.ParseConfig(tc.raw)
+
+			var cfgErr *wrapper.ConfigError
+			require.True(t, errors.As(err, &cfgErr), "unexpected error: %v", err)
+			assert.Equal(t, tc.key, cfgErr.Key)
+		})
+	}
+}
+
+func TestGetHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+	mockedLogger.EXPECT().Error(gomock.Any()).AnyTimes()
+
+	var gotID string
+	w := wrapper.NewGRPCwrapper(mockedLogger, wrapper.WrapperParam{
+		Endpoint: "/v1/app-groups/{id}",
+		Method:   "GET",
+		Handler: func(_ http.ResponseWriter, req *http.Request) {
+			gotID = req.PathValue("id")
+		},
+	})
+
+	t.Run("should match path params", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123/", nil)
+		w.GetHandler(req.URL.Path, req.Method)(httptest.NewRecorder(), req)
+		assert.Equal(t, "appgrp123", gotID)
+	})
+
+	t.Run("should not match other paths", func(t *testing.T) {
+		for _, path := range []string{"/v1/app-groups", "/v1/app-groups/appgrp123/apps"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			w.GetHandler(req.URL.Path, req.Method)(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code, path)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+)
+
+// MonitoredConn is the part of *grpc.ClientConn the monitor needs.
+type MonitoredConn interface {
+	ConnStateReporter
+	WaitForStateChange(ctx context.Context, sourceState connectivity.State) bool
+	Connect()
+}
+
+type connMonitor struct {
+	name     string
+	conns    []MonitoredConn
+	backoff  backoff.Config
+	logger   Logger
+	degraded []atomic.Bool
+}
+
+// NewConnMonitor watches conns and marks the backend degraded while all of
+// them are in TRANSIENT_FAILURE. bc should be the backoff the connections were
+// dialed with, it is only used to log when the next reconnect attempt is due.
+func NewConnMonitor(logger Logger, name string, bc backoff.Config, conns ...MonitoredConn) *connMonitor {
+	return &connMonitor{
+		name:     name,
+		conns:    conns,
+		backoff:  bc,
+		logger:   logger,
+		degraded: make([]atomic.Bool, len(conns)),
+	}
+}
+
+// Run kicks off the first connection attempts and follows the connectivity
+// state until ctx is done or the connections are shut down.
+func (m *connMonitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range m.conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.watch(ctx, i)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *connMonitor) watch(ctx context.Context, i int) {
+	conn := m.conns[i]
+	conn.Connect()
+
+	attempt := 0
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			if m.degraded[i].Swap(false) {
+				m.logger.Info("backend reachable again: ", m.name, "#", i, " after ", attempt, " reconnect attempts")
+			}
+			attempt = 0
+		case connectivity.TransientFailure:
+			m.degraded[i].Store(true)
+			attempt++
+			m.logger.Warning("backend unreachable: ", m.name, "#", i, ", reconnect attempt ", attempt, " in ", m.delay(attempt))
+		case connectivity.Shutdown:
+			return
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
+
+// Degraded reports whether the backend is currently unreachable through any connection.
+func (m *connMonitor) Degraded() bool {
+	for i := range m.degraded {
+		if !m.degraded[i].Load() {
+			return false
+		}
+	}
+	return len(m.degraded) > 0
+}
+
+// Middleware answers 503 while the backend is degraded instead of letting the
+// call fail against a broken connection. It should wrap the handler inside
+// the cache and stale-if-error middlewares, which answer during outages.
+func (m *connMonitor) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		if m.Degraded() {
+			markUnavailable(req.Context())
+			RequestLogger(req.Context(), m.logger).Warning("backend degraded, rejecting request: ", req.URL.Path)
+			respWtr.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(m.backoff.BaseDelay.Seconds()))))
+			respWtr.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		next(respWtr, req)
+	}
+}
+
+// delay mirrors the exponential backoff grpc applies between attempts, without jitter.
+func (m *connMonitor) delay(attempt int) time.Duration {
+	d := float64(m.backoff.BaseDelay) * math.Pow(m.backoff.Multiplier, float64(attempt-1))
+	return time.Duration(min(d, float64(m.backoff.MaxDelay)))
+}
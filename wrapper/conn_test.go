@@ -0,0 +1,81 @@
+package wrapper_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestConnMonitor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Warning(gomock.Any()).AnyTimes()
+	mockedLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	var reachable atomic.Bool
+	bc := backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, MaxDelay: 50 * time.Millisecond}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			if !reachable.Load() {
+				return nil, errors.New("connection refused")
+			}
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: bc, MinConnectTimeout: 50 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	monitor := wrapper.NewConnMonitor(mockedLogger, "auth", bc, conn)
+	go monitor.Run(ctx)
+
+	handler := monitor.Middleware(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("routes respond 503 while backend is unreachable", func(t *testing.T) {
+		require.Eventually(t, monitor.Degraded, 2*time.Second, 5*time.Millisecond)
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("routes recover once backend is reachable", func(t *testing.T) {
+		reachable.Store(true)
+		require.Eventually(t, func() bool { return !monitor.Degraded() }, 2*time.Second, 5*time.Millisecond)
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
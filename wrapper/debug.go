@@ -0,0 +1,258 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DebugConfig records the last requests of the routes and serves them to
+// the holders of Token.
+type DebugConfig struct {
+	// Path serves the recorded requests.
+	Path string `json:"path"`
+	// Size is the number of requests kept, the oldest being replaced first.
+	Size int `json:"size"`
+	// Token is the bearer token required to read the requests.
+	Token string `json:"token"`
+	// MaxBodySize is the size in bytes over which request bodies are not recorded.
+	MaxBodySize int `json:"max_body_size"`
+}
+
+func (c *DebugConfig) setDefaults() {
+	*c = DebugConfig{
+		Path:        "/__debug/requests",
+		Size:        100,
+		MaxBodySize: 64 << 10,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c DebugConfig) Validate(key string) error {
+	if !strings.HasPrefix(c.Path, "/") {
+		return &ConfigError{Key: joinKey(key, "path"), Err: errors.New("must start with /")}
+	}
+	if c.Size < 1 {
+		return &ConfigError{Key: joinKey(key, "size"), Err: errors.New("must be at least 1")}
+	}
+	if c.Token == "" {
+		return &ConfigError{Key: joinKey(key, "token"), Err: errors.New("is required")}
+	}
+	if c.MaxBodySize < 0 {
+		return &ConfigError{Key: joinKey(key, "max_body_size"), Err: errors.New("must not be negative")}
+	}
+	return nil
+}
+
+// DebugRequest is a request recorded by the debug recorder, with its
+// secrets redacted.
+type DebugRequest struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	URL       string    `json:"url"`
+	Body      string    `json:"body,omitempty"`
+	// BodyTruncated is set when the body was over the recorded size.
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+	RPC           string `json:"rpc"`
+	// Metadata is the metadata sent with the last call to the backend.
+	Metadata    map[string][]string `json:"metadata,omitempty"`
+	GRPCCode    string              `json:"grpc_code,omitempty"`
+	GRPCMessage string              `json:"grpc_message,omitempty"`
+	Response    DebugResponse       `json:"response"`
+}
+
+// DebugResponse summarizes the response to a recorded request.
+type DebugResponse struct {
+	Status      int     `json:"status"`
+	Bytes       int     `json:"bytes"`
+	ContentType string  `json:"content_type,omitempty"`
+	Duration    float64 `json:"duration_ms"`
+}
+
+type debugCtxKey struct{}
+
+// debugRecord is the request being recorded, filled by the interceptor.
+type debugRecord struct {
+	mu  sync.Mutex
+	req DebugRequest
+}
+
+type debugRecorder struct {
+	cfg      DebugConfig
+	redactor *Redactor
+
+	mu       sync.Mutex
+	requests []DebugRequest
+	next     int
+}
+
+// NewDebugRecorder keeps the last cfg.Size requests of the routes, redacted
+// by redactor. Use its Middleware on the routes, its UnaryClientInterceptor
+// when dialing the backend and its Params to serve the requests.
+func NewDebugRecorder(cfg DebugConfig, redactor *Redactor) *debugRecorder {
+	return &debugRecorder{cfg: cfg, redactor: redactor, requests: make([]DebugRequest, 0, cfg.Size)}
+}
+
+// Params serves the recorded requests at the configured path.
+func (d *debugRecorder) Params() []WrapperParam {
+	return []WrapperParam{{Endpoint: d.cfg.Path, Method: "GET", Handler: d.HandleRequests}}
+}
+
+// Middleware records the requests of the route endpoint served by rpc.
+func (d *debugRecorder) Middleware(endpoint, rpc string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := &debugRecord{req: DebugRequest{
+				Time:      start,
+				RequestID: RequestIDFromContext(req.Context()),
+				Method:    req.Method,
+				Route:     endpoint,
+				URL:       req.URL.Path,
+				RPC:       rpc,
+			}}
+			if req.URL.RawQuery != "" {
+				rec.req.URL += "?" + d.redactor.Form(req.URL.Query()).Encode()
+			}
+			if req.Body != nil && req.Body != http.NoBody {
+				// read one byte past the limit to tell truncated bodies apart
+				body, err := io.ReadAll(io.LimitReader(req.Body, int64(d.cfg.MaxBodySize)+1))
+				req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+				if err == nil && len(body) > d.cfg.MaxBodySize {
+					rec.req.BodyTruncated = true
+				} else if err == nil && len(body) > 0 {
+					rec.req.Body = string(d.redactor.JSON(body))
+				}
+			}
+
+			w := &statusWriter{ResponseWriter: respWtr}
+			next(w, req.WithContext(context.WithValue(req.Context(), debugCtxKey{}, rec)))
+
+			rec.mu.Lock()
+			rec.req.Response = DebugResponse{
+				Status:      w.Status(),
+				Bytes:       w.size,
+				ContentType: w.Header().Get("Content-Type"),
+				Duration:    float64(time.Since(start).Microseconds()) / 1000,
+			}
+			recorded := rec.req
+			rec.mu.Unlock()
+			d.add(recorded)
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (d *debugRecorder) add(r DebugRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.requests) < d.cfg.Size {
+		d.requests = append(d.requests, r)
+		return
+	}
+	d.requests[d.next] = r
+	d.next = (d.next + 1) % d.cfg.Size
+}
+
+// UnaryClientInterceptor records the metadata and the status of the backend
+// calls of the recorded requests.
+func (d *debugRecorder) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	rec, _ := ctx.Value(debugCtxKey{}).(*debugRecord)
+	if rec == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	st := status.Convert(err)
+	rec.mu.Lock()
+	rec.req.Metadata = d.redactor.Headers(http.Header(md))
+	rec.req.GRPCCode = st.Code().String()
+	rec.req.GRPCMessage = d.redactor.String(st.Message())
+	rec.mu.Unlock()
+	return err
+}
+
+// HandleRequests answers the recorded requests, newest first, to requests
+// bearing the token. The route query param keeps the requests of a route
+// endpoint, status those answered with a status such as 503 or a class such
+// as 5xx, and limit caps their number.
+func (d *debugRecorder) HandleRequests(respWtr http.ResponseWriter, req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.cfg.Token)) != 1 {
+		respWtr.Header().Set("WWW-Authenticate", "Bearer")
+		respWtr.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := req.URL.Query()
+	route := query.Get("route")
+	matchStatus, err := statusFilter(query.Get("status"))
+	if err != nil {
+		http.Error(respWtr, "invalid status filter", http.StatusBadRequest)
+		return
+	}
+	limit := d.cfg.Size
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			http.Error(respWtr, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	d.mu.Lock()
+	requests := make([]DebugRequest, 0, len(d.requests))
+	for i := range len(d.requests) {
+		// walk back from the newest request
+		if len(requests) == limit {
+			break
+		}
+		r := d.requests[(d.next-1-i+2*len(d.requests))%len(d.requests)]
+		if (route == "" || r.Route == route) && matchStatus(r.Response.Status) {
+			requests = append(requests, r)
+		}
+	}
+	d.mu.Unlock()
+
+	respWtr.Header().Set("Content-Type", "application/json")
+	respWtr.Header().Set("Cache-Control", "no-store")
+	respWtr.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(respWtr).Encode(map[string]interface{}{"requests": requests})
+}
+
+// statusFilter parses a status such as 503, or a class such as 5xx.
+func statusFilter(s string) (func(int) bool, error) {
+	if s == "" {
+		return func(int) bool { return true }, nil
+	}
+	if class, ok := strings.CutSuffix(strings.ToLower(s), "xx"); ok {
+		c, err := strconv.Atoi(class)
+		if err != nil || c < 1 || c > 5 {
+			return nil, errors.New("invalid status class")
+		}
+		return func(status int) bool { return status/100 == c }, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+	return func(status int) bool { return status == code }, nil
+}
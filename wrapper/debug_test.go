@@ -0,0 +1,139 @@
+package wrapper_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestDebugRecorder(t *testing.T) {
+	recorder := wrapper.NewDebugRecorder(wrapper.DebugConfig{
+		Path:        "/__debug/requests",
+		Size:        2,
+		Token:       "s3cret",
+		MaxBodySize: 64,
+	}, wrapper.NewRedactor(wrapper.RedactionConfig{}))
+
+	// route forwards the headers and answers with the status of the backend call
+	route := func(endpoint, rpc string, code codes.Code) http.HandlerFunc {
+		return wrapper.RequestID(recorder.Middleware(endpoint, rpc)(func(w http.ResponseWriter, req *http.Request) {
+			ctx := metadata.AppendToOutgoingContext(req.Context(), "authorization", req.Header.Get("Authorization"), "x-request-id", "req-1")
+			invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(code, "access_token=t1 rejected")
+			}
+			if err := recorder.UnaryClientInterceptor(ctx, "/grpc.AuthService/"+rpc, nil, nil, nil, invoker); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}))
+	}
+
+	// list reads the recorded requests matching query
+	list := func(token, query string) (int, []wrapper.DebugRequest) {
+		req := httptest.NewRequest(http.MethodGet, "/__debug/requests?"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		recorder.HandleRequests(w, req)
+		var body struct {
+			Requests []wrapper.DebugRequest `json:"requests"`
+		}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		}
+		return w.Code, body.Requests
+	}
+
+	// the first request is replaced by the third one
+	route("/v1/users", "CreateUser", codes.OK)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{}`)))
+	route("/v1/users", "CreateUser", codes.OK)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(strings.Repeat("x", 65))))
+	route("/v1/app-groups/{id}", "GetAppGroup", codes.Unavailable)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil))
+
+	t.Run("should require the token", func(t *testing.T) {
+		code, _ := list("", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = list("wrong", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("should keep the last requests, newest first", func(t *testing.T) {
+		code, requests := list("s3cret", "")
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, requests, 2)
+
+		assert.Equal(t, "/v1/app-groups/{id}", requests[0].Route)
+		assert.Equal(t, "GetAppGroup", requests[0].RPC)
+		assert.Equal(t, "Unavailable", requests[0].GRPCCode)
+		assert.Equal(t, "access_token=[REDACTED] rejected", requests[0].GRPCMessage)
+		assert.Equal(t, http.StatusServiceUnavailable, requests[0].Response.Status)
+
+		assert.True(t, requests[1].BodyTruncated)
+		assert.Empty(t, requests[1].Body)
+		assert.Equal(t, http.StatusOK, requests[1].Response.Status)
+		assert.Equal(t, "application/json", requests[1].Response.ContentType)
+		assert.Equal(t, 11, requests[1].Response.Bytes)
+	})
+
+	t.Run("should filter by route and status", func(t *testing.T) {
+		_, requests := list("s3cret", "status=5xx")
+		require.Len(t, requests, 1)
+		assert.Equal(t, "GetAppGroup", requests[0].RPC)
+
+		_, requests = list("s3cret", "route=/v1/users&status=200")
+		require.Len(t, requests, 1)
+		assert.Equal(t, "CreateUser", requests[0].RPC)
+
+		_, requests = list("s3cret", "limit=1")
+		assert.Len(t, requests, 1)
+
+		code, _ := list("s3cret", "status=abc")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("should redact bodies, queries and metadata", func(t *testing.T) {
+		recorder := wrapper.NewDebugRecorder(wrapper.DebugConfig{Path: "/__debug/requests", Size: 1, Token: "s3cret", MaxBodySize: 64}, wrapper.NewRedactor(wrapper.RedactionConfig{}))
+		var body string
+		handler := recorder.Middleware("/v1/users", "CreateUser")(func(w http.ResponseWriter, req *http.Request) {
+			// the handler still reads the whole body
+			var decoded map[string]string
+			_ = json.NewDecoder(req.Body).Decode(&decoded)
+			body = decoded["password"]
+			ctx := metadata.AppendToOutgoingContext(req.Context(), "authorization", req.Header.Get("Authorization"))
+			_ = recorder.UnaryClientInterceptor(ctx, "/grpc.AuthService/CreateUser", nil, nil, nil, func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error { return nil })
+		})
+		req := httptest.NewRequest(http.MethodPost, "/v1/users?password=hunter2", strings.NewReader(`{"email":"a@b.co","password":"hunter2"}`))
+		req.Header.Set("Authorization", "Bearer t1")
+		handler(httptest.NewRecorder(), req)
+		assert.Equal(t, "hunter2", body)
+
+		w := httptest.NewRecorder()
+		listReq := httptest.NewRequest(http.MethodGet, "/__debug/requests", nil)
+		listReq.Header.Set("Authorization", "Bearer s3cret")
+		recorder.HandleRequests(w, listReq)
+
+		assert.NotContains(t, w.Body.String(), "hunter2")
+		assert.NotContains(t, w.Body.String(), "Bearer t1")
+		var listed struct {
+			Requests []wrapper.DebugRequest `json:"requests"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+		require.Len(t, listed.Requests, 1)
+		assert.JSONEq(t, `{"email":"a@b.co","password":"[REDACTED]"}`, listed.Requests[0].Body)
+		assert.Equal(t, "/v1/users?password=%5BREDACTED%5D", listed.Requests[0].URL)
+		assert.Equal(t, []string{"[REDACTED]"}, listed.Requests[0].Metadata["authorization"])
+	})
+}
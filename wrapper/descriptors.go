@@ -0,0 +1,162 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DescriptorsConfig exposes the services of a FileDescriptorSet through the
+// transcoder, without handlers compiled in the plugin.
+type DescriptorsConfig struct {
+	// File is the FileDescriptorSet, as written by protoc --include_imports
+	// --descriptor_set_out.
+	File string `json:"file"`
+	// Services are the services of File exposed.
+	Services []ServiceConfig `json:"services"`
+}
+
+// ServiceConfig exposes a service. Its methods with a google.api.http
+// annotation are served on the annotated routes, the others on POST
+// {prefix}/{method} with the input message as JSON body.
+type ServiceConfig struct {
+	// Name is the full name of the service, such as survey.SurveyService.
+	Name string `json:"name"`
+	// Prefix defaults to /{name}, the path of the grpc methods.
+	Prefix string `json:"prefix"`
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c DescriptorsConfig) Validate(key string) error {
+	if c.File == "" {
+		return &ConfigError{Key: joinKey(key, "file"), Err: errors.New("is required")}
+	}
+	if len(c.Services) == 0 {
+		return &ConfigError{Key: joinKey(key, "services"), Err: errors.New("must list at least one service")}
+	}
+	return validateServices(joinKey(key, "services"), c.Services)
+}
+
+func validateServices(key string, services []ServiceConfig) error {
+	for i, s := range services {
+		key := fmt.Sprintf("%s[%d]", key, i)
+		if s.Name == "" {
+			return &ConfigError{Key: key + ".name", Err: errors.New("is required")}
+		}
+		if s.Prefix != "" && (!strings.HasPrefix(s.Prefix, "/") || strings.HasSuffix(s.Prefix, "/")) {
+			return &ConfigError{Key: key + ".prefix", Err: errors.New("must start with / and not end with /")}
+		}
+	}
+	return nil
+}
+
+// LoadDescriptorSet reads the FileDescriptorSet at path. The set must hold
+// the imported files too.
+func LoadDescriptorSet(path string) (*protoregistry.Files, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("%s is not a FileDescriptorSet: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return files, nil
+}
+
+// ServiceRoutes builds the routes of services, looked up in files. Streaming
+// methods are not routed.
+func ServiceRoutes(files *protoregistry.Files, services []ServiceConfig) ([]RouteConfig, error) {
+	var routes []RouteConfig
+	seen := make(map[string]string)
+	for _, s := range services {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(s.Name))
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", s.Name, err)
+		}
+		service, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", s.Name)
+		}
+		prefix := s.Prefix
+		if prefix == "" {
+			prefix = "/" + s.Name
+		}
+
+		methods := service.Methods()
+		for i := range methods.Len() {
+			md := methods.Get(i)
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+			annotated, err := methodRoutes(md)
+			if err != nil {
+				return nil, err
+			}
+			if annotated == nil {
+				annotated = []RouteConfig{{
+					Endpoint: prefix + "/" + string(md.Name()),
+					Method:   "POST",
+					RPC:      string(md.Name()),
+					HTTPRule: &HTTPRule{Method: md, Body: "*"},
+				}}
+			}
+			for _, route := range annotated {
+				key := route.Method + " " + route.Endpoint
+				if other, ok := seen[key]; ok {
+					return nil, fmt.Errorf("%s and %s are both routed on %s", other, md.FullName(), key)
+				}
+				seen[key] = string(md.FullName())
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes, nil
+}
+
+// ResolveRoutes returns the routes served for cfg: its configured routes, the
+// annotated AuthService routes when RouteSource is "annotations", and the
+// routes of the Descriptors services. The configured routes matching no
+// annotated route are returned as unmatched and not served.
+func ResolveRoutes(cfg Config) (routes, unmatched []RouteConfig, err error) {
+	routes = cfg.Routes
+	if cfg.RouteSource == "annotations" {
+		annotated, err := AnnotatedRoutes(client.File_service_proto.Services().ByName("AuthService"))
+		if err != nil {
+			return nil, nil, &ConfigError{Key: "route_source", Err: err}
+		}
+		routes, unmatched = MergeRoutes(annotated, routes)
+	}
+	if cfg.Descriptors != nil {
+		files, err := LoadDescriptorSet(cfg.Descriptors.File)
+		if err != nil {
+			return nil, nil, &ConfigError{Key: "descriptors.file", Err: err}
+		}
+		described, err := ServiceRoutes(files, cfg.Descriptors.Services)
+		if err != nil {
+			return nil, nil, &ConfigError{Key: "descriptors.services", Err: err}
+		}
+		routes = WithServiceRoutes(routes, described)
+	}
+	return routes, unmatched, nil
+}
+
+// WithServiceRoutes adds the routes of described services to routes. The
+// routes on the same method and endpoint as a described one only give it
+// their options.
+func WithServiceRoutes(routes, described []RouteConfig) []RouteConfig {
+	described, rest := MergeRoutes(described, routes)
+	return append(rest, described...)
+}
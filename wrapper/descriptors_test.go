@@ -0,0 +1,145 @@
+package wrapper_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// writeDescriptorSet writes fd and its imports as protoc --include_imports does.
+func writeDescriptorSet(t *testing.T, fd protoreflect.FileDescriptor) string {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	add(fd)
+
+	b, err := proto.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "services.pb")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	return path
+}
+
+func TestServiceRoutes(t *testing.T) {
+	files, err := wrapper.LoadDescriptorSet(writeDescriptorSet(t, annotatedFile(t, groupRules)))
+	require.NoError(t, err)
+
+	t.Run("should route the methods by name or annotation", func(t *testing.T) {
+		routes, err := wrapper.ServiceRoutes(files, []wrapper.ServiceConfig{{Name: "groups.Groups"}})
+		require.NoError(t, err)
+
+		var got []string
+		for _, r := range routes {
+			got = append(got, r.Method+" "+r.Endpoint+" "+r.HTTPRule.FullMethod())
+		}
+		assert.Equal(t, []string{
+			"GET /v1/groups/{id} /groups.Groups/GetGroup",
+			"POST /v1/groups /groups.Groups/CreateGroup",
+			"PUT /v1/groups/{id} /groups.Groups/UpdateGroup",
+			"PATCH /v1/groups/{group.id} /groups.Groups/UpdateGroup",
+			"POST /groups.Groups/DeleteGroup /groups.Groups/DeleteGroup",
+		}, got)
+		assert.Equal(t, "*", routes[4].HTTPRule.Body)
+	})
+
+	t.Run("should serve the methods under the prefix", func(t *testing.T) {
+		routes, err := wrapper.ServiceRoutes(files, []wrapper.ServiceConfig{{Name: "groups.Groups", Prefix: "/v1/rpc/groups"}})
+		require.NoError(t, err)
+		route := routes[len(routes)-1]
+		assert.Equal(t, "/v1/rpc/groups/DeleteGroup", route.Endpoint)
+
+		ctrl := gomock.NewController(t)
+		logger := mocks.NewMockLogger(ctrl)
+		logger.EXPECT().Info(gomock.Any()).AnyTimes()
+		conn := &fakeConn{reply: `{"group":{"id":"g1"},"etag":"v2"}`}
+		w := httptest.NewRecorder()
+		wrapper.NewTranscoder(logger, conn, 0).Handler(route.HTTPRule)(w, httptest.NewRequest(http.MethodPost, route.Endpoint, strings.NewReader(`{"id":"g1"}`)))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/groups.Groups/DeleteGroup", conn.method)
+		assert.JSONEq(t, `{"id":"g1"}`, conn.in)
+		assert.JSONEq(t, `{"group":{"id":"g1"},"etag":"v2"}`, w.Body.String())
+	})
+
+	t.Run("should reject unknown services", func(t *testing.T) {
+		_, err := wrapper.ServiceRoutes(files, []wrapper.ServiceConfig{{Name: "groups.Teams"}})
+		assert.Error(t, err)
+		_, err = wrapper.ServiceRoutes(files, []wrapper.ServiceConfig{{Name: "groups.Group"}})
+		assert.EqualError(t, err, "groups.Group is not a service")
+	})
+
+	t.Run("should reject services routed on the same endpoints", func(t *testing.T) {
+		_, err := wrapper.ServiceRoutes(files, []wrapper.ServiceConfig{{Name: "groups.Groups"}, {Name: "groups.Groups"}})
+		assert.EqualError(t, err, "groups.Groups.GetGroup and groups.Groups.GetGroup are both routed on GET /v1/groups/{id}")
+	})
+
+	t.Run("should reject invalid descriptor sets", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "services.pb")
+		require.NoError(t, os.WriteFile(path, []byte("not a descriptor set"), 0o600))
+		_, err := wrapper.LoadDescriptorSet(path)
+		assert.Error(t, err)
+
+		_, err = wrapper.LoadDescriptorSet(filepath.Join(t.TempDir(), "missing.pb"))
+		assert.Error(t, err)
+	})
+}
+
+func TestResolveRoutes(t *testing.T) {
+	t.Run("should route the annotated auth service methods", func(t *testing.T) {
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host":         "auth:50051",
+			"route_source": "annotations",
+			"routes": []interface{}{
+				map[string]interface{}{"endpoint": "/v1/app-groups/{id}", "method": "GET", "rpc": "GetAppGroup", "cache": map[string]interface{}{}},
+				map[string]interface{}{"endpoint": "/v1/app-groups", "method": "GET", "rpc": "GetAppGroup"},
+			},
+		})
+		require.NoError(t, err)
+
+		routes, unmatched, err := wrapper.ResolveRoutes(cfg)
+		require.NoError(t, err)
+		var got []string
+		for _, r := range routes {
+			require.NotNil(t, r.HTTPRule)
+			got = append(got, r.Method+" "+r.Endpoint+" "+r.RPC)
+			if r.Endpoint == "/v1/app-groups/{id}" && r.Method == "GET" {
+				assert.NotNil(t, r.Cache)
+			}
+		}
+		assert.ElementsMatch(t, []string{
+			"POST /v1/users/token UserToken",
+			"POST /v1/users CreateUser",
+			"POST /v1/app-groups CreateAppGroup",
+			"PUT /v1/app-groups/{id} UpdateAppGroup",
+			"GET /v1/app-groups/{id} GetAppGroup",
+			"POST /v1/apps CreateApp",
+		}, got)
+		require.Len(t, unmatched, 1)
+		assert.Equal(t, "/v1/app-groups", unmatched[0].Endpoint)
+	})
+}
@@ -0,0 +1,369 @@
+package wrapper
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionalphapb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DiscoveryConfig discovers the services of the backend through its grpc
+// reflection service and exposes them through the transcoder.
+type DiscoveryConfig struct {
+	// Services are the services exposed, all of those listed by the backend
+	// but the reflection, health and channelz ones when empty.
+	Services []ServiceConfig `json:"services"`
+	// RefreshInterval is how often the services are discovered again, the
+	// routes being rebuilt when they changed.
+	RefreshInterval Duration `json:"refresh_interval"`
+	// Timeout bounds a discovery.
+	Timeout Duration `json:"timeout"`
+}
+
+func (c *DiscoveryConfig) setDefaults() {
+	*c = DiscoveryConfig{
+		RefreshInterval: Duration(time.Minute),
+		Timeout:         Duration(5 * time.Second),
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c DiscoveryConfig) Validate(key string) error {
+	if c.RefreshInterval <= 0 {
+		return &ConfigError{Key: joinKey(key, "refresh_interval"), Err: errors.New("must be positive")}
+	}
+	if c.Timeout <= 0 {
+		return &ConfigError{Key: joinKey(key, "timeout"), Err: errors.New("must be positive")}
+	}
+	return validateServices(joinKey(key, "services"), c.Services)
+}
+
+// Descriptors are the services found by a discovery and the files
+// describing them.
+type Descriptors struct {
+	Files    *protoregistry.Files
+	Services []ServiceConfig
+	digest   [sha256.Size]byte
+}
+
+// Discovery keeps the last descriptors discovered, across reloads, so that
+// they keep being served while the backend reflection fails. It reaches the
+// backend through a connection of its own, so that a single Refresh loop
+// serves every generation of the routes.
+type Discovery struct {
+	logger  Logger
+	dial    func(host string) (*grpc.ClientConn, error)
+	changed chan struct{}
+
+	mu   sync.Mutex
+	last *Descriptors
+	host string
+	conn *grpc.ClientConn
+}
+
+// NewDiscovery returns a discovery with no known descriptors, reaching the
+// backends through the connections dial returns.
+func NewDiscovery(logger Logger, dial func(host string) (*grpc.ClientConn, error)) *Discovery {
+	return &Discovery{logger: logger, dial: dial, changed: make(chan struct{}, 1)}
+}
+
+// Changed signals that Refresh discovered descriptors different from the
+// ones last known.
+func (d *Discovery) Changed() <-chan struct{} {
+	return d.changed
+}
+
+// Last returns the last known descriptors, nil when none were discovered.
+func (d *Discovery) Last() *Descriptors {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+// Discover queries the reflection service of the cfg.Host backend and keeps
+// the result as the last known descriptors, reporting whether they changed.
+// It does nothing when cfg has no Discovery. When it fails, the last known
+// descriptors are kept.
+func (d *Discovery) Discover(ctx context.Context, cfg Config) (changed bool, err error) {
+	if cfg.Discovery == nil {
+		return false, nil
+	}
+	conn, err := d.connTo(cfg.Host)
+	if err != nil {
+		return false, err
+	}
+	found, err := discover(ctx, conn, *cfg.Discovery)
+	if err != nil {
+		return false, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed = d.last == nil || d.last.digest != found.digest
+	if changed {
+		d.last = found
+	}
+	return changed, nil
+}
+
+// connTo returns the connection to host, dialing it again when the host
+// changed since the last discovery.
+func (d *Discovery) connTo(host string) (*grpc.ClientConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != nil && d.host == host {
+		return d.conn, nil
+	}
+	conn, err := d.dial(host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client for host %q: %w", host, err)
+	}
+	if d.conn != nil {
+		d.conn.Close()
+	}
+	d.host, d.conn = host, conn
+	return conn, nil
+}
+
+// Refresh discovers the services of the config current returns every
+// refresh interval until ctx is done, signaling Changed when they differ
+// from the last known ones, then closes the connection. Failures are logged
+// and the last known descriptors kept.
+func (d *Discovery) Refresh(ctx context.Context, current func() Config) {
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.conn != nil {
+			d.conn.Close()
+			d.conn = nil
+		}
+	}()
+	for {
+		// the interval of the current config, or the default one to notice
+		// when a reload enables the discovery
+		var interval DiscoveryConfig
+		interval.setDefaults()
+		if cfg := current().Discovery; cfg != nil {
+			interval = *cfg
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(interval.RefreshInterval)):
+		}
+
+		changed, err := d.Discover(ctx, current())
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Warning("service discovery failed, keeping the last known services: ", err)
+			}
+			continue
+		}
+		if changed {
+			select {
+			case d.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// internalServices are the prefixes of the services grpc servers register
+// for their own tooling, not exposed unless named in the config.
+var internalServices = []string{"grpc.reflection.", "grpc.health.", "grpc.channelz."}
+
+// discover lists the services of the backend, when cfg does not name them,
+// and fetches the files describing them. Backends only serving the
+// v1alpha reflection service are queried through it.
+func discover(ctx context.Context, conn grpc.ClientConnInterface, cfg DiscoveryConfig) (*Descriptors, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	defer cancel()
+	found, err := discoverWith(ctx, cfg, v1Reflection(conn))
+	if status.Code(err) == codes.Unimplemented {
+		found, err = discoverWith(ctx, cfg, v1alphaReflection(conn))
+	}
+	return found, err
+}
+
+// reflectionStream opens a reflection stream, returning its call func and
+// the func closing it.
+type reflectionStream func(ctx context.Context) (call func(*reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error), closeSend func() error, err error)
+
+func v1Reflection(conn grpc.ClientConnInterface) reflectionStream {
+	return func(ctx context.Context) (func(*reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error), func() error, error) {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+			if err := stream.Send(req); err != nil {
+				return nil, err
+			}
+			return stream.Recv()
+		}, stream.CloseSend, nil
+	}
+}
+
+// v1alphaReflection converts the v1 messages to and from their v1alpha
+// counterparts, which have the same wire format.
+func v1alphaReflection(conn grpc.ClientConnInterface) reflectionStream {
+	return func(ctx context.Context) (func(*reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error), func() error, error) {
+		stream, err := reflectionalphapb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+			alphaReq := &reflectionalphapb.ServerReflectionRequest{}
+			if err := convertMessage(req, alphaReq); err != nil {
+				return nil, err
+			}
+			if err := stream.Send(alphaReq); err != nil {
+				return nil, err
+			}
+			alphaResp, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			resp := &reflectionpb.ServerReflectionResponse{}
+			if err := convertMessage(alphaResp, resp); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}, stream.CloseSend, nil
+	}
+}
+
+func convertMessage(from, to proto.Message) error {
+	b, err := proto.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, to)
+}
+
+// discoverWith runs a discovery on a stream opened by open.
+func discoverWith(ctx context.Context, cfg DiscoveryConfig, open reflectionStream) (*Descriptors, error) {
+	send, closeSend, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = closeSend() }()
+	call := func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		resp, err := send(req)
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+		}
+		return resp, nil
+	}
+
+	services := slices.Clone(cfg.Services)
+	if len(services) == 0 {
+		resp, err := call(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the services: %w", err)
+		}
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			if !slices.ContainsFunc(internalServices, func(prefix string) bool { return strings.HasPrefix(s.GetName(), prefix) }) {
+				services = append(services, ServiceConfig{Name: s.GetName()})
+			}
+		}
+	}
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	add := func(resp *reflectionpb.ServerReflectionResponse) error {
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return err
+			}
+			files[fd.GetName()] = fd
+		}
+		return nil
+	}
+	for _, s := range services {
+		resp, err := call(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: s.Name},
+		})
+		if err == nil {
+			err = add(resp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe %s: %w", s.Name, err)
+		}
+	}
+	// servers do not send again the files already sent on the stream, nor
+	// always every import
+	for missing := missingImports(files); len(missing) > 0; missing = missingImports(files) {
+		for _, name := range missing {
+			resp, err := call(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err == nil {
+				err = add(resp)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to fetch %s: %w", name, err)
+			}
+			if files[name] == nil {
+				return nil, fmt.Errorf("unable to fetch %s: not sent by the backend", name)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		set.File = append(set.File, files[name])
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.New()
+	for _, s := range services {
+		fmt.Fprintln(digest, s.Name, s.Prefix)
+	}
+	for _, fd := range set.File {
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(fd)
+		if err != nil {
+			return nil, err
+		}
+		digest.Write(b)
+	}
+	found := &Descriptors{Files: registry, Services: services}
+	copy(found.digest[:], digest.Sum(nil))
+	return found, nil
+}
+
+// missingImports lists the imports of files not in files.
+func missingImports(files map[string]*descriptorpb.FileDescriptorProto) []string {
+	var missing []string
+	for _, fd := range files {
+		for _, dep := range fd.GetDependency() {
+			if files[dep] == nil && !slices.Contains(missing, dep) {
+				missing = append(missing, dep)
+			}
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
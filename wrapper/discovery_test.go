@@ -0,0 +1,177 @@
+package wrapper_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionalphapb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// reflectedServices lists the services a reflection server reports, as
+// registered on a grpc server.
+type reflectedServices struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (s *reflectedServices) set(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names = names
+}
+
+func (s *reflectedServices) GetServiceInfo() map[string]grpc.ServiceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := make(map[string]grpc.ServiceInfo, len(s.names))
+	for _, name := range s.names {
+		info[name] = grpc.ServiceInfo{}
+	}
+	return info
+}
+
+// reflectionBackend serves the reflection of services and files on bufconn,
+// through the v1 service or, when alpha is set, the v1alpha one only. The
+// returned dial func reaches it.
+func reflectionBackend(t *testing.T, services *reflectedServices, files *protoregistry.Files, alpha bool) func(string) (*grpc.ClientConn, error) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	opts := reflection.ServerOptions{Services: services, DescriptorResolver: files}
+	if alpha {
+		reflectionalphapb.RegisterServerReflectionServer(server, reflection.NewServer(opts))
+	} else {
+		reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(opts))
+	}
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return func(host string) (*grpc.ClientConn, error) {
+		return grpc.NewClient(host,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Warning(gomock.Any()).AnyTimes()
+
+	files, err := wrapper.LoadDescriptorSet(writeDescriptorSet(t, annotatedFile(t, groupRules)))
+	require.NoError(t, err)
+	services := &reflectedServices{names: []string{"groups.Groups", "grpc.health.v1.Health"}}
+	dial := reflectionBackend(t, services, files, false)
+
+	config := func(cfg wrapper.DiscoveryConfig) wrapper.Config {
+		return wrapper.Config{Host: "passthrough:///bufnet", Discovery: &cfg}
+	}
+	discoveryCfg := wrapper.DiscoveryConfig{RefreshInterval: wrapper.Duration(10 * time.Millisecond), Timeout: wrapper.Duration(time.Second)}
+
+	t.Run("should discover the listed services", func(t *testing.T) {
+		discovery := wrapper.NewDiscovery(mockedLogger, dial)
+		changed, err := discovery.Discover(context.Background(), config(discoveryCfg))
+		require.NoError(t, err)
+		assert.True(t, changed)
+		found := discovery.Last()
+		assert.Equal(t, []wrapper.ServiceConfig{{Name: "groups.Groups"}}, found.Services)
+
+		routes, err := wrapper.ServiceRoutes(found.Files, found.Services)
+		require.NoError(t, err)
+		assert.Len(t, routes, 5)
+		assert.Equal(t, "/groups.Groups/DeleteGroup", routes[4].Endpoint)
+
+		changed, err = discovery.Discover(context.Background(), config(discoveryCfg))
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("should discover through the v1alpha reflection service", func(t *testing.T) {
+		discovery := wrapper.NewDiscovery(mockedLogger, reflectionBackend(t, services, files, true))
+		_, err := discovery.Discover(context.Background(), config(discoveryCfg))
+		require.NoError(t, err)
+		assert.Equal(t, []wrapper.ServiceConfig{{Name: "groups.Groups"}}, discovery.Last().Services)
+	})
+
+	t.Run("should discover the configured services only", func(t *testing.T) {
+		cfg := discoveryCfg
+		cfg.Services = []wrapper.ServiceConfig{{Name: "groups.Groups", Prefix: "/v1/rpc/groups"}}
+		discovery := wrapper.NewDiscovery(mockedLogger, dial)
+		_, err := discovery.Discover(context.Background(), config(cfg))
+		require.NoError(t, err)
+		assert.Equal(t, cfg.Services, discovery.Last().Services)
+
+		cfg.Services = []wrapper.ServiceConfig{{Name: "groups.Teams"}}
+		_, err = wrapper.NewDiscovery(mockedLogger, dial).Discover(context.Background(), config(cfg))
+		assert.Error(t, err)
+	})
+
+	t.Run("should fall back to the last known services", func(t *testing.T) {
+		discovery := wrapper.NewDiscovery(mockedLogger, dial)
+		_, err := discovery.Discover(context.Background(), config(discoveryCfg))
+		require.NoError(t, err)
+		known := discovery.Last()
+
+		broken := discoveryCfg
+		broken.Services = []wrapper.ServiceConfig{{Name: "groups.Teams"}}
+		_, err = discovery.Discover(context.Background(), config(broken))
+		assert.Error(t, err)
+		assert.Same(t, known, discovery.Last())
+
+		discovery = wrapper.NewDiscovery(mockedLogger, dial)
+		_, err = discovery.Discover(context.Background(), config(broken))
+		assert.Error(t, err)
+		assert.Nil(t, discovery.Last())
+	})
+
+	t.Run("should signal the services changes", func(t *testing.T) {
+		services.set()
+		defer services.set("groups.Groups", "grpc.health.v1.Health")
+
+		discovery := wrapper.NewDiscovery(mockedLogger, dial)
+		_, err := discovery.Discover(context.Background(), config(discoveryCfg))
+		require.NoError(t, err)
+		assert.Empty(t, discovery.Last().Services)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go discovery.Refresh(ctx, func() wrapper.Config { return config(discoveryCfg) })
+
+		select {
+		case <-discovery.Changed():
+			t.Fatal("signaled without changes")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		services.set("groups.Groups")
+		select {
+		case <-discovery.Changed():
+		case <-time.After(time.Second):
+			t.Fatal("the new service was not signaled")
+		}
+		assert.Equal(t, []wrapper.ServiceConfig{{Name: "groups.Groups"}}, discovery.Last().Services)
+	})
+
+	t.Run("should not discover without a discovery config", func(t *testing.T) {
+		discovery := wrapper.NewDiscovery(mockedLogger, dial)
+		changed, err := discovery.Discover(context.Background(), wrapper.Config{Host: "passthrough:///bufnet"})
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.Nil(t, discovery.Last())
+	})
+}
@@ -0,0 +1,45 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ETag returns a strong entity tag of msg, computed from its deterministic
+// wire encoding so that the same message always gets the same tag. It
+// returns "" when msg cannot be marshaled.
+func ETag(msg proto.Message) string {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header. If-None-Match uses the weak comparison, ignoring W/ prefixes, while
+// If-Match requires strong tags.
+func etagMatches(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
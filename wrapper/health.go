@@ -0,0 +1,147 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	HealthEndpoint = "/__health"
+	ReadyEndpoint  = "/__ready"
+
+	defaultHealthCheckTimeout = 2 * time.Second
+)
+
+// ConnStateReporter is the part of *grpc.ClientConn readiness needs.
+type ConnStateReporter interface {
+	GetState() connectivity.State
+}
+
+// Backend is an upstream gRPC service the plugin depends on.
+type Backend struct {
+	Name string
+	Conn ConnStateReporter
+	// Health is used to run a grpc.health.v1 check against the backend.
+	Health grpc_health_v1.HealthClient
+	// Service is the service name sent in the health check, empty means the whole server.
+	Service string
+}
+
+type backendStatus struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	ServingStatus string  `json:"serving_status"`
+	LatencyMs     float64 `json:"latency_ms"`
+	Error         string  `json:"error,omitempty"`
+	Ready         bool    `json:"ready"`
+}
+
+type healthResponse struct {
+	Status   string          `json:"status"`
+	Backends []backendStatus `json:"backends,omitempty"`
+}
+
+type healthHandler struct {
+	backends []Backend
+	timeout  time.Duration
+	logger   Logger
+}
+
+// NewHealthHandler serves liveness and readiness for the given backends.
+// Health routes never reach the backend handlers, so no auth headers are
+// required or forwarded for them.
+func NewHealthHandler(logger Logger, timeout time.Duration, backends ...Backend) *healthHandler {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	return &healthHandler{
+		backends: backends,
+		timeout:  timeout,
+		logger:   logger,
+	}
+}
+
+// Params returns the wrapper params registering the health routes.
+func (h *healthHandler) Params() []WrapperParam {
+	return []WrapperParam{
+		{Endpoint: HealthEndpoint, Method: "GET", Handler: h.HandleHealth},
+		{Endpoint: ReadyEndpoint, Method: "GET", Handler: h.HandleReady},
+	}
+}
+
+// HandleHealth reports that the plugin is loaded and serving, it does not
+// touch the backends.
+func (h *healthHandler) HandleHealth(respWtr http.ResponseWriter, req *http.Request) {
+	writeHealth(respWtr, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// HandleReady checks every backend concurrently and answers 503 unless all of
+// them are reachable and serving.
+func (h *healthHandler) HandleReady(respWtr http.ResponseWriter, req *http.Request) {
+	statuses := make([]backendStatus, len(h.backends))
+
+	var wg sync.WaitGroup
+	for i, b := range h.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = h.check(req.Context(), b)
+		}()
+	}
+	wg.Wait()
+
+	resp := healthResponse{Status: "ok", Backends: statuses}
+	code := http.StatusOK
+	for _, s := range statuses {
+		if !s.Ready {
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			msg := fmt.Sprintf("backend %s not ready: %s, %s", s.Name, s.State, s.ServingStatus)
+			if s.Error != "" {
+				msg += ": " + s.Error
+			}
+			h.logger.Warning(msg)
+		}
+	}
+	writeHealth(respWtr, code, resp)
+}
+
+func (h *healthHandler) check(ctx context.Context, b Backend) backendStatus {
+	status := backendStatus{
+		Name:          b.Name,
+		ServingStatus: grpc_health_v1.HealthCheckResponse_UNKNOWN.String(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := b.Health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: b.Service})
+	status.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	// the check itself may move an idle connection to ready, so read the state afterwards
+	if b.Conn != nil {
+		status.State = b.Conn.GetState().String()
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.ServingStatus = resp.GetStatus().String()
+	status.Ready = resp.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING
+	return status
+}
+
+func writeHealth(respWtr http.ResponseWriter, code int, resp healthResponse) {
+	respWtr.Header().Set("Content-Type", "application/json")
+	respWtr.Header().Set("Cache-Control", "no-store")
+	respWtr.WriteHeader(code)
+	_ = json.NewEncoder(respWtr).Encode(resp)
+}
@@ -0,0 +1,113 @@
+package wrapper_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newHealthBackend(t *testing.T) (*health.Server, *grpc.ClientConn) {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return hs, conn
+}
+
+func TestHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	hs, conn := newHealthBackend(t)
+
+	h := wrapper.NewHealthHandler(mockedLogger, 0, wrapper.Backend{
+		Name:   "auth",
+		Conn:   conn,
+		Health: grpc_health_v1.NewHealthClient(conn),
+	})
+
+	type response struct {
+		Status   string `json:"status"`
+		Backends []struct {
+			Name          string  `json:"name"`
+			State         string  `json:"state"`
+			ServingStatus string  `json:"serving_status"`
+			LatencyMs     float64 `json:"latency_ms"`
+			Error         string  `json:"error"`
+			Ready         bool    `json:"ready"`
+		} `json:"backends"`
+	}
+
+	t.Run("health does not depend on backends", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.HandleHealth(w, httptest.NewRequest(http.MethodGet, wrapper.HealthEndpoint, nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp response
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, "ok", resp.Status)
+		assert.Empty(t, resp.Backends)
+	})
+
+	t.Run("ready when backend is serving", func(t *testing.T) {
+		hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+
+		w := httptest.NewRecorder()
+		h.HandleReady(w, httptest.NewRequest(http.MethodGet, wrapper.ReadyEndpoint, nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp response
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, "ok", resp.Status)
+		require.Len(t, resp.Backends, 1)
+		assert.Equal(t, "auth", resp.Backends[0].Name)
+		assert.Equal(t, "READY", resp.Backends[0].State)
+		assert.Equal(t, "SERVING", resp.Backends[0].ServingStatus)
+		assert.True(t, resp.Backends[0].Ready)
+	})
+
+	t.Run("not ready when backend is not serving", func(t *testing.T) {
+		hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+		mockedLogger.EXPECT().Warning("backend auth not ready: READY, NOT_SERVING")
+
+		w := httptest.NewRecorder()
+		h.HandleReady(w, httptest.NewRequest(http.MethodGet, wrapper.ReadyEndpoint, nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		var resp response
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, "unavailable", resp.Status)
+		require.Len(t, resp.Backends, 1)
+		assert.Equal(t, "NOT_SERVING", resp.Backends[0].ServingStatus)
+		assert.False(t, resp.Backends[0].Ready)
+	})
+}
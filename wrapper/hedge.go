@@ -0,0 +1,166 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// HedgeConfig opts a read route into hedged backend calls.
+type HedgeConfig struct {
+	// Delay is how long an attempt may run before the next one is sent,
+	// typically the p95 latency of the RPC.
+	Delay Duration `json:"delay"`
+	// MaxAttempts caps the attempts of a call, the first one included.
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// maxHedgeAttempts keeps a misconfigured route from multiplying the backend load.
+const maxHedgeAttempts = 5
+
+func (c *HedgeConfig) setDefaults() {
+	*c = HedgeConfig{
+		Delay:       Duration(50 * time.Millisecond),
+		MaxAttempts: 2,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c HedgeConfig) Validate(key string) error {
+	if c.Delay <= 0 {
+		return &ConfigError{Key: joinKey(key, "delay"), Err: errors.New("must be positive")}
+	}
+	if c.MaxAttempts < 2 || c.MaxAttempts > maxHedgeAttempts {
+		return &ConfigError{Key: joinKey(key, "max_attempts"), Err: errors.New("must be between 2 and 5")}
+	}
+	return nil
+}
+
+// HedgeStats counts the hedged calls.
+type HedgeStats struct {
+	Calls uint64 `json:"calls"`
+	// Hedged is the number of extra attempts sent.
+	Hedged uint64 `json:"hedged"`
+	// Wins is the number of calls answered by an extra attempt.
+	Wins uint64 `json:"wins"`
+}
+
+type hedgeCtxKey struct{}
+
+// hedgeAttempt is one of the backend calls sent for a hedged call.
+type hedgeAttempt struct {
+	flight
+	index int
+}
+
+type hedger struct {
+	pool    *connPool
+	onHedge func(method string)
+	calls   atomic.Uint64
+	hedged  atomic.Uint64
+	wins    atomic.Uint64
+}
+
+// NewHedger wraps pool so that the calls of the routes using its Middleware
+// are hedged across the pooled connections. onHedge, when not nil, is called
+// with the method of every extra attempt sent.
+func NewHedger(pool *connPool, onHedge func(method string)) *hedger {
+	return &hedger{pool: pool, onHedge: onHedge}
+}
+
+// Middleware marks the requests of a route as eligible for hedging.
+func (h *hedger) Middleware(cfg HedgeConfig) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			next(respWtr, req.WithContext(context.WithValue(req.Context(), hedgeCtxKey{}, cfg)))
+		}
+	}
+}
+
+// Invoke sends the call to a pooled connection and, every Delay it stays
+// unanswered, another attempt to the next connection. The first successful
+// attempt wins and the others are cancelled. An attempt failing does not
+// trigger a new one, its error is returned once no other attempt is running.
+func (h *hedger) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	cfg, ok := ctx.Value(hedgeCtxKey{}).(HedgeConfig)
+	msg, isMsg := reply.(proto.Message)
+	if !ok || !isMsg {
+		return h.pool.Invoke(ctx, method, args, reply, opts...)
+	}
+	h.calls.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every attempt gets its own reply and header, the winner's are copied back
+	var attemptOpts []grpc.CallOption
+	for _, opt := range opts {
+		if _, ok := opt.(grpc.HeaderCallOption); !ok {
+			attemptOpts = append(attemptOpts, opt)
+		}
+	}
+	conns := h.pool.order(cfg.MaxAttempts)
+	results := make(chan *hedgeAttempt, len(conns))
+	launch := func(i int) {
+		attemptCtx := ctx
+		if i > 0 {
+			// an extra attempt joining the coalesced first one would be pointless
+			attemptCtx = context.WithValue(ctx, coalesceCtxKey{}, nil)
+		}
+		a := &hedgeAttempt{flight: flight{reply: msg.ProtoReflect().New().Interface()}, index: i}
+		callOpts := append(slices.Clip(attemptOpts), grpc.Header(&a.header))
+		go func() {
+			a.err = conns[i].Invoke(attemptCtx, method, args, a.reply, callOpts...)
+			results <- a
+		}()
+	}
+
+	launch(0)
+	launched, running := 1, 1
+	timer := time.NewTimer(time.Duration(cfg.Delay))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if launched == len(conns) {
+				continue
+			}
+			h.hedged.Add(1)
+			if h.onHedge != nil {
+				h.onHedge(method)
+			}
+			launch(launched)
+			launched++
+			running++
+			timer.Reset(time.Duration(cfg.Delay))
+		case a := <-results:
+			running--
+			if a.err != nil && running > 0 {
+				continue
+			}
+			if a.err == nil && a.index > 0 {
+				h.wins.Add(1)
+			}
+			return a.copyTo(reply, opts)
+		}
+	}
+}
+
+func (h *hedger) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return h.pool.NewStream(ctx, desc, method, opts...)
+}
+
+// Stats returns how many calls were eligible, hedged and won by a hedge.
+func (h *hedger) Stats() HedgeStats {
+	return HedgeStats{
+		Calls:  h.calls.Load(),
+		Hedged: h.hedged.Load(),
+		Wins:   h.wins.Load(),
+	}
+}
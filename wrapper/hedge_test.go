@@ -0,0 +1,94 @@
+package wrapper_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// slowHealthServer stalls the first check it receives until it is cancelled.
+type slowHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	checks    atomic.Int32
+	cancelled chan struct{}
+}
+
+func (s *slowHealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if s.checks.Add(1) == 1 {
+		<-ctx.Done()
+		close(s.cancelled)
+		return nil, ctx.Err()
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func TestHedger(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	backend := &slowHealthServer{cancelled: make(chan struct{})}
+	grpc_health_v1.RegisterHealthServer(srv, backend)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	pool, err := wrapper.DialPool("passthrough:///bufnet", 2,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	var hedgedMethods []string
+	hedger := wrapper.NewHedger(pool, func(method string) { hedgedMethods = append(hedgedMethods, method) })
+	hc := grpc_health_v1.NewHealthClient(hedger)
+
+	check := func(req *http.Request) (*grpc_health_v1.HealthCheckResponse, time.Duration, error) {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		start := time.Now()
+		resp, err := hc.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return resp, time.Since(start), err
+	}
+
+	t.Run("should answer with the hedge and cancel the slow attempt", func(t *testing.T) {
+		var (
+			resp    *grpc_health_v1.HealthCheckResponse
+			elapsed time.Duration
+			err     error
+		)
+		handler := hedger.Middleware(wrapper.HedgeConfig{Delay: wrapper.Duration(20 * time.Millisecond), MaxAttempts: 2})(func(_ http.ResponseWriter, req *http.Request) {
+			resp, elapsed, err = check(req)
+		})
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil))
+
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+		assert.Less(t, elapsed, 500*time.Millisecond)
+		select {
+		case <-backend.cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("the slow attempt was not cancelled")
+		}
+		assert.Equal(t, wrapper.HedgeStats{Calls: 1, Hedged: 1, Wins: 1}, hedger.Stats())
+		assert.Equal(t, []string{"/grpc.health.v1.Health/Check"}, hedgedMethods)
+	})
+
+	t.Run("should not hedge routes without hedging", func(t *testing.T) {
+		_, _, err := check(httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), hedger.Stats().Calls)
+	})
+}
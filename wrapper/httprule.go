@@ -0,0 +1,188 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// HTTPRule binds an RPC to a route, as declared by its google.api.http
+// annotation.
+type HTTPRule struct {
+	Method protoreflect.MethodDescriptor
+	// Body is the input field filled from the request body, "*" for the
+	// whole input message and empty for no body. The input fields bound
+	// neither to the body nor to the path are read from the query params.
+	Body string
+	// ResponseBody is the output field answered, empty for the whole output message.
+	ResponseBody string
+	// PathParams are the input fields bound to the {field} segments of the
+	// route endpoint, named after them.
+	PathParams []string
+}
+
+// FullMethod is the grpc name of the method, such as /grpc.AuthService/UserToken.
+func (r *HTTPRule) FullMethod() string {
+	return fmt.Sprintf("/%s/%s", r.Method.Parent().FullName(), r.Method.Name())
+}
+
+// AnnotatedRoutes builds the routes of the google.api.http annotations of
+// service, one per binding. Methods without annotation are not routed.
+func AnnotatedRoutes(service protoreflect.ServiceDescriptor) ([]RouteConfig, error) {
+	var routes []RouteConfig
+	methods := service.Methods()
+	for i := range methods.Len() {
+		annotated, err := methodRoutes(methods.Get(i))
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, annotated...)
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("%s has no google.api.http annotation", service.FullName())
+	}
+	return routes, nil
+}
+
+// methodRoutes builds the routes of the google.api.http annotation of md,
+// none when it has no annotation.
+func methodRoutes(md protoreflect.MethodDescriptor) ([]RouteConfig, error) {
+	if !proto.HasExtension(md.Options(), annotations.E_Http) {
+		return nil, nil
+	}
+	rule := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	var routes []RouteConfig
+	for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		route, err := annotatedRoute(md, binding)
+		if err != nil {
+			return nil, fmt.Errorf("google.api.http of %s: %w", md.FullName(), err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func annotatedRoute(md protoreflect.MethodDescriptor, binding *annotations.HttpRule) (RouteConfig, error) {
+	var method, template string
+	switch pattern := binding.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, template = "GET", pattern.Get
+	case *annotations.HttpRule_Put:
+		method, template = "PUT", pattern.Put
+	case *annotations.HttpRule_Post:
+		method, template = "POST", pattern.Post
+	case *annotations.HttpRule_Delete:
+		method, template = "DELETE", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, template = "PATCH", pattern.Patch
+	default:
+		return RouteConfig{}, errors.New("only get, put, post, delete and patch patterns are supported")
+	}
+
+	rule := &HTTPRule{Method: md, Body: binding.GetBody(), ResponseBody: binding.GetResponseBody()}
+	endpoint, params, err := parseTemplate(template)
+	if err != nil {
+		return RouteConfig{}, err
+	}
+	for _, param := range params {
+		fd, err := fieldByPath(md.Input(), param)
+		if err != nil {
+			return RouteConfig{}, err
+		}
+		if fd.IsList() || fd.IsMap() || fd.Kind() == protoreflect.MessageKind {
+			return RouteConfig{}, fmt.Errorf("path param %q must be a singular scalar field", param)
+		}
+	}
+	rule.PathParams = params
+	// as in the google.api.http spec, body and response_body name top level
+	// fields
+	if rule.Body != "" && rule.Body != "*" {
+		if strings.Contains(rule.Body, ".") {
+			return RouteConfig{}, fmt.Errorf("body %q must be a top level field", rule.Body)
+		}
+		if _, err := fieldByPath(md.Input(), rule.Body); err != nil {
+			return RouteConfig{}, err
+		}
+	}
+	if rule.ResponseBody != "" {
+		if strings.Contains(rule.ResponseBody, ".") {
+			return RouteConfig{}, fmt.Errorf("response_body %q must be a top level field", rule.ResponseBody)
+		}
+		if _, err := fieldByPath(md.Output(), rule.ResponseBody); err != nil {
+			return RouteConfig{}, err
+		}
+	}
+	return RouteConfig{Endpoint: endpoint, Method: method, RPC: string(md.Name()), HTTPRule: rule}, nil
+}
+
+// parseTemplate turns a path template such as /v1/app-groups/{id} into a
+// route endpoint and the field paths of its variables. Variables only match
+// a single segment, {field=*} being the same as {field}.
+func parseTemplate(template string) (string, []string, error) {
+	if !strings.HasPrefix(template, "/") {
+		return "", nil, fmt.Errorf("path %q must start with /", template)
+	}
+	if strings.Contains(template, ":") {
+		return "", nil, fmt.Errorf("path %q: verbs are not supported", template)
+	}
+	var params []string
+	segments := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	for i, segment := range segments {
+		variable, ok := strings.CutPrefix(segment, "{")
+		if !ok {
+			if strings.ContainsAny(segment, "*{}") {
+				return "", nil, fmt.Errorf("path %q: only {field} variables are supported", template)
+			}
+			continue
+		}
+		variable, ok = strings.CutSuffix(variable, "}")
+		field, pattern, hasPattern := strings.Cut(variable, "=")
+		if !ok || field == "" || (hasPattern && pattern != "*") {
+			return "", nil, fmt.Errorf("path %q: only {field} variables are supported", template)
+		}
+		segments[i] = "{" + field + "}"
+		params = append(params, field)
+	}
+	return "/" + strings.Join(segments, "/"), params, nil
+}
+
+// fieldByPath finds the field of md at a dotted path such as user.id.
+func fieldByPath(md protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	var fd protoreflect.FieldDescriptor
+	for _, name := range strings.Split(path, ".") {
+		if fd != nil {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return nil, fmt.Errorf("field %q of %s is not a message", fd.Name(), md.FullName())
+			}
+			md = fd.Message()
+		}
+		if fd = md.Fields().ByName(protoreflect.Name(name)); fd == nil {
+			return nil, fmt.Errorf("%s has no field %q", md.FullName(), name)
+		}
+	}
+	return fd, nil
+}
+
+// MergeRoutes gives the annotated routes the options, such as caches or
+// bulkheads, of the configured routes with the same method and endpoint. The
+// configured routes matching no annotated route are returned as unmatched.
+func MergeRoutes(annotated, configured []RouteConfig) (routes, unmatched []RouteConfig) {
+	routes = slices.Clone(annotated)
+	for _, c := range configured {
+		i := slices.IndexFunc(routes, func(r RouteConfig) bool {
+			return strings.EqualFold(r.Method, c.Method) && r.Endpoint == c.Endpoint
+		})
+		if i < 0 {
+			unmatched = append(unmatched, c)
+			continue
+		}
+		c.Method, c.RPC, c.HTTPRule = routes[i].Method, routes[i].RPC, routes[i].HTTPRule
+		routes[i] = c
+	}
+	return routes, unmatched
+}
@@ -0,0 +1,224 @@
+package wrapper_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// annotatedFile describes a groups service annotated like the grpc-gateway
+// examples, rules maps its methods to their google.api.http annotation.
+func annotatedFile(t *testing.T, rules map[string]*annotations.HttpRule) protoreflect.FileDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		str      = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		boolean  = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+		int32t   = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		int64t   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		enum     = descriptorpb.FieldDescriptorProto_TYPE_ENUM
+		message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	method := func(name, input, output string) *descriptorpb.MethodDescriptorProto {
+		m := &descriptorpb.MethodDescriptorProto{Name: proto.String(name), InputType: proto.String(input), OutputType: proto.String(output)}
+		if rule, ok := rules[name]; ok {
+			m.Options = &descriptorpb.MethodOptions{}
+			proto.SetExtension(m.Options, annotations.E_Http, rule)
+		}
+		return m
+	}
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("groups.proto"),
+		Package:    proto.String("groups"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto", "google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Visibility"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("VISIBILITY_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("PUBLIC"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Group"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, optional, ""),
+				field("name", 2, str, optional, ""),
+				field("scopes", 3, str, repeated, ""),
+				field("size", 4, int32t, optional, ""),
+				field("members", 5, int64t, optional, ""),
+				field("visibility", 6, enum, optional, ".groups.Visibility"),
+				field("created_at", 7, message, optional, ".google.protobuf.Timestamp"),
+			}},
+			{Name: proto.String("GetGroupRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, optional, ""),
+				field("verbose", 2, boolean, optional, ""),
+				field("fields", 3, str, repeated, ""),
+			}},
+			{Name: proto.String("UpdateGroupRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, optional, ""),
+				field("group", 2, message, optional, ".groups.Group"),
+				field("dry_run", 3, boolean, optional, ""),
+			}},
+			{Name: proto.String("GroupResponse"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("group", 1, message, optional, ".groups.Group"),
+				field("etag", 2, str, optional, ""),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Groups"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetGroup", ".groups.GetGroupRequest", ".groups.GroupResponse"),
+				method("CreateGroup", ".groups.Group", ".groups.GroupResponse"),
+				method("UpdateGroup", ".groups.UpdateGroupRequest", ".groups.GroupResponse"),
+				method("DeleteGroup", ".groups.GetGroupRequest", ".groups.GroupResponse"),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd
+}
+
+// groupRules are the annotations of the groups service.
+var groupRules = map[string]*annotations.HttpRule{
+	"GetGroup": {
+		Pattern:      &annotations.HttpRule_Get{Get: "/v1/groups/{id}"},
+		ResponseBody: "group",
+	},
+	"CreateGroup": {
+		Pattern: &annotations.HttpRule_Post{Post: "/v1/groups"},
+		Body:    "*",
+	},
+	"UpdateGroup": {
+		Pattern: &annotations.HttpRule_Put{Put: "/v1/groups/{id=*}"},
+		Body:    "group",
+		AdditionalBindings: []*annotations.HttpRule{
+			{Pattern: &annotations.HttpRule_Patch{Patch: "/v1/groups/{group.id}"}, Body: "group"},
+		},
+	},
+}
+
+func TestAnnotatedRoutes(t *testing.T) {
+	service := annotatedFile(t, groupRules).Services().ByName("Groups")
+
+	t.Run("should build a route per binding", func(t *testing.T) {
+		routes, err := wrapper.AnnotatedRoutes(service)
+		require.NoError(t, err)
+
+		type route struct{ method, endpoint, rpc, body, responseBody, fullMethod string }
+		var got []route
+		for _, r := range routes {
+			got = append(got, route{r.Method, r.Endpoint, r.RPC, r.HTTPRule.Body, r.HTTPRule.ResponseBody, r.HTTPRule.FullMethod()})
+		}
+		assert.Equal(t, []route{
+			{"GET", "/v1/groups/{id}", "GetGroup", "", "group", "/groups.Groups/GetGroup"},
+			{"POST", "/v1/groups", "CreateGroup", "*", "", "/groups.Groups/CreateGroup"},
+			{"PUT", "/v1/groups/{id}", "UpdateGroup", "group", "", "/groups.Groups/UpdateGroup"},
+			{"PATCH", "/v1/groups/{group.id}", "UpdateGroup", "group", "", "/groups.Groups/UpdateGroup"},
+		}, got)
+		assert.Equal(t, []string{"group.id"}, routes[3].HTTPRule.PathParams)
+	})
+
+	t.Run("should keep the options of the configured routes", func(t *testing.T) {
+		routes, err := wrapper.AnnotatedRoutes(service)
+		require.NoError(t, err)
+
+		merged, unmatched := wrapper.MergeRoutes(routes, []wrapper.RouteConfig{
+			{Endpoint: "/v1/groups/{id}", Method: "get", RPC: "GetAppGroup", Bulkhead: "reads"},
+			{Endpoint: "/v1/users", Method: "POST", RPC: "CreateUser"},
+		})
+		assert.Equal(t, "reads", merged[0].Bulkhead)
+		assert.Equal(t, "GetGroup", merged[0].RPC)
+		assert.Equal(t, "GET", merged[0].Method)
+		assert.NotNil(t, merged[0].HTTPRule)
+		require.Len(t, unmatched, 1)
+		assert.Equal(t, "/v1/users", unmatched[0].Endpoint)
+	})
+
+	t.Run("should describe the annotated routes", func(t *testing.T) {
+		routes, err := wrapper.AnnotatedRoutes(service)
+		require.NoError(t, err)
+		doc, err := wrapper.OpenAPI(routes, service)
+		require.NoError(t, err)
+
+		get, _ := json.Marshal(doc.Paths["/v1/groups/{id}"]["get"].Parameters)
+		assert.JSONEq(t, `[
+			{"name":"id","in":"path","required":true,"schema":{"type":"string"}},
+			{"name":"verbose","in":"query","required":false,"schema":{"type":"boolean"}},
+			{"name":"fields","in":"query","required":false,"schema":{"type":"array","items":{"type":"string"}}}
+		]`, string(get))
+		assert.Equal(t, "#/components/schemas/groups.Group", doc.Paths["/v1/groups/{id}"]["get"].Responses["200"].Content["application/json"].Schema.Ref)
+		assert.Equal(t, "#/components/schemas/groups.Group", doc.Paths["/v1/groups"]["post"].RequestBody.Content["application/json"].Schema.Ref)
+		assert.NotContains(t, doc.Paths["/v1/groups/{id}"]["put"].Responses, "412")
+
+		group, _ := json.Marshal(doc.Components.Schemas["groups.Group"])
+		assert.JSONEq(t, `{"type":"object","properties":{
+			"id":{"type":"string"},
+			"name":{"type":"string"},
+			"scopes":{"type":"array","items":{"type":"string"}},
+			"size":{"type":"integer","format":"int32"},
+			"members":{"type":"string","format":"int64"},
+			"visibility":{"type":"string","enum":["VISIBILITY_UNSPECIFIED","PUBLIC"]},
+			"created_at":{"type":"string","format":"date-time"}
+		}}`, string(group))
+	})
+
+	t.Run("should give each operation its own id", func(t *testing.T) {
+		routes, err := wrapper.AnnotatedRoutes(service)
+		require.NoError(t, err)
+		doc, err := wrapper.OpenAPI(routes, service)
+		require.NoError(t, err)
+
+		assert.Equal(t, "groups.Groups.GetGroup", doc.Paths["/v1/groups/{id}"]["get"].OperationID)
+		assert.Equal(t, "groups.Groups.UpdateGroup", doc.Paths["/v1/groups/{id}"]["put"].OperationID)
+		assert.Equal(t, "groups.Groups.UpdateGroup_2", doc.Paths["/v1/groups/{group.id}"]["patch"].OperationID)
+	})
+
+	t.Run("should reject unsupported annotations", func(t *testing.T) {
+		for name, rule := range map[string]*annotations.HttpRule{
+			"verb":            {Pattern: &annotations.HttpRule_Post{Post: "/v1/groups/{id}:archive"}},
+			"multi segment":   {Pattern: &annotations.HttpRule_Get{Get: "/v1/{id=groups/*}"}},
+			"unknown field":   {Pattern: &annotations.HttpRule_Get{Get: "/v1/groups/{uid}"}},
+			"message param":   {Pattern: &annotations.HttpRule_Get{Get: "/v1/groups/{group}"}},
+			"unknown body":    {Pattern: &annotations.HttpRule_Post{Post: "/v1/groups/{id}"}, Body: "payload"},
+			"nested body":     {Pattern: &annotations.HttpRule_Post{Post: "/v1/groups/{id}"}, Body: "group.name"},
+			"nested response": {Pattern: &annotations.HttpRule_Get{Get: "/v1/groups/{id}"}, ResponseBody: "group.id"},
+			"custom pattern":  {Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "HEAD", Path: "/v1/groups"}}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				service := annotatedFile(t, map[string]*annotations.HttpRule{"UpdateGroup": rule}).Services().ByName("Groups")
+				_, err := wrapper.AnnotatedRoutes(service)
+				assert.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("should require annotations", func(t *testing.T) {
+		_, err := wrapper.AnnotatedRoutes(annotatedFile(t, nil).Services().ByName("Groups"))
+		assert.EqualError(t, err, "groups.Groups has no google.api.http annotation")
+	})
+}
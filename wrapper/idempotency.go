@@ -0,0 +1,223 @@
+package wrapper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyConfig opts a POST route into honouring the Idempotency-Key header.
+type IdempotencyConfig struct {
+	// TTL is how long the response to a key is replayed.
+	TTL Duration `json:"ttl"`
+	// Headers are the request headers scoping the keys, so that two users
+	// picking the same key never see each other's response. As for the
+	// response cache, Authorization always is one of them.
+	Headers []string `json:"headers"`
+	// MaxBodySize is the size in bytes over which request bodies, kept in
+	// memory to be fingerprinted, are rejected.
+	MaxBodySize int `json:"max_body_size"`
+}
+
+func (c *IdempotencyConfig) setDefaults() {
+	*c = IdempotencyConfig{
+		TTL:         Duration(24 * time.Hour),
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c IdempotencyConfig) Validate(key string) error {
+	if c.TTL <= 0 {
+		return &ConfigError{Key: joinKey(key, "ttl"), Err: errors.New("must be positive")}
+	}
+	if c.MaxBodySize <= 0 {
+		return &ConfigError{Key: joinKey(key, "max_body_size"), Err: errors.New("must be positive")}
+	}
+	return nil
+}
+
+// IdempotencyRecord is what an IdempotencyStore keeps for a key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request first sent with the key.
+	Fingerprint string
+	// Response is nil while that request is in flight.
+	Response *CachedResponse
+}
+
+// IdempotencyStore keeps the requests made with an Idempotency-Key and their
+// responses. The in-memory store is used by default, a shared store can
+// implement this interface so that retries landing on another gateway
+// instance are replayed too.
+type IdempotencyStore interface {
+	// Reserve records an in-flight request for key and returns true, or
+	// returns the existing record and false when key is already used.
+	Reserve(key, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool)
+	// Complete stores the response to the request reserved under key.
+	Complete(key string, resp CachedResponse)
+	// Release forgets key, so that a failed request can be retried.
+	Release(key string)
+}
+
+type memoryIdempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore keeps the records in memory, expired ones are
+// dropped at most once a minute.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry)}
+}
+
+func (s *memoryIdempotencyStore) Reserve(key, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.record, false
+	}
+	s.entries[key] = &memoryIdempotencyEntry{
+		record:  IdempotencyRecord{Fingerprint: fingerprint},
+		expires: now.Add(ttl),
+	}
+	return IdempotencyRecord{}, true
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, resp CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.record.Response = &resp
+		e.expires = resp.Expires
+	}
+}
+
+func (s *memoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// Idempotency returns the in-memory idempotency store of endpoint.
+func (s *RouteStores) Idempotency(endpoint string) IdempotencyStore {
+	return s.get("idempotency "+endpoint, 0, func() any { return NewMemoryIdempotencyStore() }).(IdempotencyStore)
+}
+
+type idempotency struct {
+	cfg     IdempotencyConfig
+	store   IdempotencyStore
+	headers []string
+	logger  Logger
+}
+
+// NewIdempotency replays the responses of a POST route to requests retried
+// with the same Idempotency-Key, keeping them in store.
+func NewIdempotency(logger Logger, cfg IdempotencyConfig, store IdempotencyStore) *idempotency {
+	return &idempotency{
+		cfg:     cfg,
+		store:   store,
+		headers: keyHeaders(cfg.Headers),
+		logger:  logger,
+	}
+}
+
+// Middleware answers a request carrying a known Idempotency-Key with the
+// stored response, 422 when its body differs from the first one, 409 while
+// the first one is still in flight and 413 when its body is over the max body
+// size. Requests failing with a 5xx are
+// forgotten so that they can be retried.
+func (i *idempotency) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		idemKey := req.Header.Get("Idempotency-Key")
+		if idemKey == "" {
+			next(respWtr, req)
+			return
+		}
+		logger := RequestLogger(req.Context(), i.logger)
+
+		body, err := io.ReadAll(http.MaxBytesReader(respWtr, req.Body, int64(i.cfg.MaxBodySize)))
+		if err != nil {
+			logger.Error("error while reading request body: ", err)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respWtr.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			respWtr.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(req.Method+" "+req.URL.RequestURI()+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+		key := requestKey(req, i.headers) + "\x00" + idemKey
+
+		ttl := time.Duration(i.cfg.TTL)
+		record, reserved := i.store.Reserve(key, fingerprint, ttl)
+		switch {
+		case reserved:
+		case record.Fingerprint != fingerprint:
+			logger.Warning("Idempotency-Key reused with another request: ", idemKey)
+			respWtr.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		case record.Response == nil:
+			logger.Warning("Idempotency-Key already in flight: ", idemKey)
+			respWtr.WriteHeader(http.StatusConflict)
+			return
+		default:
+			logger.Debug("replaying response for Idempotency-Key ", idemKey)
+			writeReplayed(respWtr, *record.Response)
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				i.store.Release(key)
+			}
+		}()
+		capture := newResponseCapture(respWtr)
+		next(capture, req)
+		if capture.Status() >= 500 {
+			return
+		}
+		now := time.Now()
+		i.store.Complete(key, CachedResponse{
+			Status:   capture.Status(),
+			Header:   capture.header,
+			Body:     capture.body.Bytes(),
+			StoredAt: now,
+			Expires:  now.Add(ttl),
+		})
+		completed = true
+	}
+}
+
+func writeReplayed(respWtr http.ResponseWriter, resp CachedResponse) {
+	for k, vs := range resp.Header {
+		respWtr.Header()[k] = append([]string(nil), vs...)
+	}
+	respWtr.Header().Set("Idempotent-Replayed", "true")
+	respWtr.WriteHeader(resp.Status)
+	_, _ = respWtr.Write(resp.Body)
+}
@@ -0,0 +1,128 @@
+package wrapper_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestIdempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Debug(gomock.Any()).AnyTimes()
+	mockedLogger.EXPECT().Warning(gomock.Any()).AnyTimes()
+	mockedLogger.EXPECT().Error(gomock.Any()).AnyTimes()
+
+	var (
+		backendCalls int
+		status       = http.StatusCreated
+		// release, when set, blocks the backend until it is closed
+		release chan struct{}
+	)
+	backend := func(w http.ResponseWriter, req *http.Request) {
+		backendCalls++
+		if release != nil {
+			<-release
+		}
+		body, _ := io.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}
+
+	newRoute := func() http.HandlerFunc {
+		cfg := wrapper.IdempotencyConfig{TTL: wrapper.Duration(time.Minute), MaxBodySize: 64}
+		return wrapper.NewIdempotency(mockedLogger, cfg, wrapper.NewMemoryIdempotencyStore()).Middleware(backend)
+	}
+
+	post := func(h http.HandlerFunc, key, auth, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		req.Header.Set("Authorization", auth)
+		h(w, req)
+		return w
+	}
+
+	t.Run("should replay the response to a retried request", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusCreated
+		h := newRoute()
+
+		first := post(h, "key-1", "user-a", `{"email":"a@example.com"}`)
+		replay := post(h, "key-1", "user-a", `{"email":"a@example.com"}`)
+
+		assert.Equal(t, 1, backendCalls)
+		assert.Equal(t, http.StatusCreated, replay.Code)
+		assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, "application/json", replay.Header().Get("Content-Type"))
+		assert.Equal(t, first.Body.String(), replay.Body.String())
+	})
+
+	t.Run("should not share a key between callers", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusCreated
+		h := newRoute()
+
+		post(h, "key-1", "user-a", `{"email":"a@example.com"}`)
+		other := post(h, "key-1", "user-b", `{"email":"a@example.com"}`)
+
+		assert.Equal(t, 2, backendCalls)
+		assert.Equal(t, http.StatusCreated, other.Code)
+		assert.Empty(t, other.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("should reject another body under the same key", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusCreated
+		h := newRoute()
+
+		post(h, "key-1", "user-a", `{"email":"a@example.com"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, post(h, "key-1", "user-a", `{"email":"b@example.com"}`).Code)
+		assert.Equal(t, 1, backendCalls)
+	})
+
+	t.Run("should reject a duplicate while the first request is in flight", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusCreated
+		h := newRoute()
+		release = make(chan struct{})
+		defer func() { release = nil }()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			post(h, "key-1", "user-a", `{}`)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Equal(t, http.StatusConflict, post(h, "key-1", "user-a", `{}`).Code)
+		close(release)
+		<-done
+	})
+
+	t.Run("should let failed requests be retried", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusServiceUnavailable
+		h := newRoute()
+
+		post(h, "key-1", "user-a", `{}`)
+		status = http.StatusCreated
+		assert.Equal(t, http.StatusCreated, post(h, "key-1", "user-a", `{}`).Code)
+		assert.Equal(t, 2, backendCalls)
+	})
+
+	t.Run("should reject a body over the max body size", func(t *testing.T) {
+		backendCalls, status = 0, http.StatusCreated
+		h := newRoute()
+
+		w := post(h, "key-1", "user-a", `{"email":"`+strings.Repeat("a", 64)+`@example.com"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Zero(t, backendCalls)
+	})
+}
@@ -0,0 +1,229 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	LimitAlgorithmAIMD     = "aimd"
+	LimitAlgorithmGradient = "gradient"
+)
+
+// AdaptiveLimitConfig configures the concurrency limit applied to the calls
+// towards the backend, adjusted from their latency and errors.
+type AdaptiveLimitConfig struct {
+	// Algorithm is "aimd" or "gradient".
+	Algorithm    string `json:"algorithm"`
+	InitialLimit int    `json:"initial_limit"`
+	MinLimit     int    `json:"min_limit"`
+	MaxLimit     int    `json:"max_limit"`
+	// BackoffRatio multiplies the limit on congestion, used by aimd.
+	BackoffRatio float64 `json:"backoff_ratio"`
+	// LatencyThreshold is the latency above which aimd treats a call as congestion.
+	LatencyThreshold Duration `json:"latency_threshold"`
+	// Smoothing weighs each new gradient estimate against the current limit, used by gradient.
+	Smoothing float64 `json:"smoothing"`
+	// Tolerance is how much slower than the long term average calls may get
+	// before gradient shrinks the limit.
+	Tolerance float64 `json:"tolerance"`
+}
+
+// DefaultAdaptiveLimitConfig returns the defaults filled in for unset keys.
+func DefaultAdaptiveLimitConfig() AdaptiveLimitConfig {
+	return AdaptiveLimitConfig{
+		Algorithm:        LimitAlgorithmAIMD,
+		InitialLimit:     20,
+		MinLimit:         1,
+		MaxLimit:         200,
+		BackoffRatio:     0.9,
+		LatencyThreshold: Duration(time.Second),
+		Smoothing:        0.2,
+		Tolerance:        1.5,
+	}
+}
+
+func (c *AdaptiveLimitConfig) setDefaults() {
+	*c = DefaultAdaptiveLimitConfig()
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c AdaptiveLimitConfig) Validate(key string) error {
+	if c.Algorithm != LimitAlgorithmAIMD && c.Algorithm != LimitAlgorithmGradient {
+		return &ConfigError{Key: joinKey(key, "algorithm"), Err: fmt.Errorf("must be %q or %q", LimitAlgorithmAIMD, LimitAlgorithmGradient)}
+	}
+	if c.MinLimit < 1 {
+		return &ConfigError{Key: joinKey(key, "min_limit"), Err: errors.New("must be at least 1")}
+	}
+	if c.MaxLimit < c.MinLimit {
+		return &ConfigError{Key: joinKey(key, "max_limit"), Err: errors.New("must not be lower than min_limit")}
+	}
+	if c.InitialLimit < c.MinLimit || c.InitialLimit > c.MaxLimit {
+		return &ConfigError{Key: joinKey(key, "initial_limit"), Err: errors.New("must be between min_limit and max_limit")}
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		return &ConfigError{Key: joinKey(key, "backoff_ratio"), Err: errors.New("must be between 0 and 1")}
+	}
+	if c.LatencyThreshold <= 0 {
+		return &ConfigError{Key: joinKey(key, "latency_threshold"), Err: errors.New("must be positive")}
+	}
+	if c.Smoothing <= 0 || c.Smoothing > 1 {
+		return &ConfigError{Key: joinKey(key, "smoothing"), Err: errors.New("must be in (0, 1]")}
+	}
+	if c.Tolerance < 1 {
+		return &ConfigError{Key: joinKey(key, "tolerance"), Err: errors.New("must be at least 1")}
+	}
+	return nil
+}
+
+// limitAlgorithm computes the next limit from the outcome of one call.
+type limitAlgorithm interface {
+	update(limit float64, rtt time.Duration, inFlight int, congested bool) float64
+}
+
+// aimd grows the limit by one while calls are fast and cuts it by
+// BackoffRatio on every slow or failed call.
+type aimd struct {
+	cfg AdaptiveLimitConfig
+}
+
+func (a *aimd) update(limit float64, rtt time.Duration, inFlight int, congested bool) float64 {
+	if congested || rtt > time.Duration(a.cfg.LatencyThreshold) {
+		return limit * a.cfg.BackoffRatio
+	}
+	// only grow when the limit is actually being used
+	if float64(inFlight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// gradient compares the latest latency with its long term average and moves
+// the limit by their ratio, shrinking it as soon as the backend slows down.
+type gradient struct {
+	cfg     AdaptiveLimitConfig
+	longRTT float64
+}
+
+func (g *gradient) update(limit float64, rtt time.Duration, inFlight int, congested bool) float64 {
+	sample := float64(rtt)
+	if g.longRTT == 0 {
+		g.longRTT = sample
+	}
+	// the long term average moves slowly so that a sustained slowdown is noticed
+	g.longRTT = g.longRTT*0.95 + sample*0.05
+
+	ratio := 0.5
+	if !congested {
+		ratio = max(0.5, min(1, g.cfg.Tolerance*g.longRTT/sample))
+	}
+	// sqrt(limit) leaves room for some queueing when latencies are steady
+	next := limit*ratio + math.Sqrt(limit)
+	return limit*(1-g.cfg.Smoothing) + next*g.cfg.Smoothing
+}
+
+// AdaptiveLimitStats is a snapshot of the adaptive limiter.
+type AdaptiveLimitStats struct {
+	Algorithm string `json:"algorithm"`
+	Limit     int    `json:"limit"`
+	InFlight  int    `json:"in_flight"`
+	Shed      uint64 `json:"shed"`
+}
+
+type adaptiveLimiter struct {
+	cfg       AdaptiveLimitConfig
+	algorithm limitAlgorithm
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	shed     uint64
+}
+
+// NewAdaptiveLimiter builds the limiter described by cfg, use its
+// UnaryClientInterceptor when dialing the backend.
+func NewAdaptiveLimiter(cfg AdaptiveLimitConfig) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		cfg:   cfg,
+		limit: float64(cfg.InitialLimit),
+	}
+	switch cfg.Algorithm {
+	case LimitAlgorithmGradient:
+		l.algorithm = &gradient{cfg: cfg}
+	default:
+		l.algorithm = &aimd{cfg: cfg}
+	}
+	return l
+}
+
+// UnaryClientInterceptor sheds calls over the current limit with Unavailable
+// before they reach the backend, and feeds the outcome of the others back
+// into the limit. Health checks are never limited.
+func (l *adaptiveLimiter) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if !l.acquire() {
+		return status.Error(codes.Unavailable, "adaptive concurrency limit reached")
+	}
+
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	l.release(time.Since(start), err)
+	return err
+}
+
+func (l *adaptiveLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		l.shed++
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *adaptiveLimiter) release(rtt time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// a canceled call says nothing about the backend
+	if status.Code(err) != codes.Canceled {
+		next := l.algorithm.update(l.limit, rtt, l.inFlight, congested(err))
+		l.limit = max(float64(l.cfg.MinLimit), min(float64(l.cfg.MaxLimit), next))
+	}
+	l.inFlight--
+}
+
+// congested reports whether err signals an overloaded or unreachable backend.
+// ResourceExhausted is left out, grpc also reports the messages over the size
+// limits with it.
+func congested(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stats returns the current limit and usage.
+func (l *adaptiveLimiter) Stats() AdaptiveLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return AdaptiveLimitStats{
+		Algorithm: l.cfg.Algorithm,
+		Limit:     int(l.limit),
+		InFlight:  l.inFlight,
+		Shed:      l.shed,
+	}
+}
@@ -0,0 +1,125 @@
+package wrapper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	const method = "/grpc.AuthService/GetAppGroup"
+
+	invokerReturning := func(err error, delay time.Duration) grpc.UnaryInvoker {
+		return func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+			time.Sleep(delay)
+			return err
+		}
+	}
+
+	t.Run("should parse defaults for unset keys", func(t *testing.T) {
+		cfg, err := wrapper.ParseConfig(map[string]interface{}{
+			"host":           "auth:50051",
+			"adaptive_limit": map[string]interface{}{"algorithm": "gradient", "max_limit": 50},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, cfg.AdaptiveLimit)
+
+		expected := wrapper.DefaultAdaptiveLimitConfig()
+		expected.Algorithm = wrapper.LimitAlgorithmGradient
+		expected.MaxLimit = 50
+		assert.Equal(t, expected, *cfg.AdaptiveLimit)
+	})
+
+	t.Run("should shed calls over the limit", func(t *testing.T) {
+		cfg := wrapper.DefaultAdaptiveLimitConfig()
+		cfg.InitialLimit = 1
+		l := wrapper.NewAdaptiveLimiter(cfg)
+
+		unblock := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil,
+				func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+					<-unblock
+					return nil
+				})
+		}()
+		require.Eventually(t, func() bool { return l.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+
+		err := l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(nil, 0))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, uint64(1), l.Stats().Shed)
+
+		close(unblock)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("aimd should shrink on errors and grow when healthy", func(t *testing.T) {
+		cfg := wrapper.DefaultAdaptiveLimitConfig()
+		cfg.InitialLimit = 2
+		cfg.MaxLimit = 4
+		cfg.BackoffRatio = 0.5
+		l := wrapper.NewAdaptiveLimiter(cfg)
+
+		for range 3 {
+			_ = l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(status.Error(codes.Unavailable, "down"), 0))
+		}
+		assert.Equal(t, cfg.MinLimit, l.Stats().Limit)
+
+		for range 10 {
+			_ = l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(nil, 0))
+		}
+		// sequential calls only use one slot, so the limit stops growing once it is not used by half
+		assert.Equal(t, 3, l.Stats().Limit)
+	})
+
+	t.Run("should not shrink on oversize messages", func(t *testing.T) {
+		cfg := wrapper.DefaultAdaptiveLimitConfig()
+		cfg.InitialLimit = 2
+		cfg.BackoffRatio = 0.5
+		l := wrapper.NewAdaptiveLimiter(cfg)
+
+		for range 3 {
+			_ = l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000 vs. 4096)"), 0))
+		}
+		assert.GreaterOrEqual(t, l.Stats().Limit, 2)
+	})
+
+	t.Run("gradient should shrink when latency rises", func(t *testing.T) {
+		cfg := wrapper.DefaultAdaptiveLimitConfig()
+		cfg.Algorithm = wrapper.LimitAlgorithmGradient
+		cfg.InitialLimit = 100
+		cfg.Smoothing = 1
+		l := wrapper.NewAdaptiveLimiter(cfg)
+
+		for range 5 {
+			_ = l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(nil, time.Millisecond))
+		}
+		healthy := l.Stats().Limit
+
+		for range 3 {
+			_ = l.UnaryClientInterceptor(context.Background(), method, nil, nil, nil, invokerReturning(nil, 20*time.Millisecond))
+		}
+		assert.Less(t, l.Stats().Limit, healthy)
+	})
+
+	t.Run("health checks are never limited", func(t *testing.T) {
+		cfg := wrapper.DefaultAdaptiveLimitConfig()
+		cfg.InitialLimit = 1
+		l := wrapper.NewAdaptiveLimiter(cfg)
+
+		for range 3 {
+			err := l.UnaryClientInterceptor(context.Background(), "/grpc.health.v1.Health/Check", nil, nil, nil, invokerReturning(status.Error(codes.Unavailable, "down"), 0))
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+		}
+		assert.Equal(t, uint64(0), l.Stats().Shed)
+		assert.Equal(t, 1, l.Stats().Limit)
+	})
+}
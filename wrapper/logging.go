@@ -0,0 +1,256 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// logFields are the attributes of a request added to each of its log events.
+// They are filled as the request goes through the middlewares and the
+// backend call.
+type logFields struct {
+	mu        sync.Mutex
+	requestID string
+	clientIP  string
+	route     string
+	rpc       string
+	grpcCode  string
+	latency   time.Duration
+}
+
+type logFieldsCtxKey struct{}
+
+func logFieldsFrom(ctx context.Context) *logFields {
+	f, _ := ctx.Value(logFieldsCtxKey{}).(*logFields)
+	return f
+}
+
+func (f *logFields) attrs() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attrs := make([]slog.Attr, 0, 6)
+	for _, a := range []slog.Attr{
+		slog.String("request_id", f.requestID),
+		slog.String("client_ip", f.clientIP),
+		slog.String("route", f.route),
+		slog.String("rpc", f.rpc),
+		slog.String("grpc_code", f.grpcCode),
+	} {
+		if a.Value.String() != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	if f.grpcCode != "" {
+		attrs = append(attrs, slog.Duration("latency", f.latency))
+	}
+	return attrs
+}
+
+// clientIP returns the first address of X-Forwarded-For, set by KrakenD and
+// the proxies in front of it, or the peer address.
+func clientIP(req *http.Request) string {
+	if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+		ip, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(ip)
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// LogRoute adds the route endpoint and the rpc serving it to the log events
+// of its requests.
+func LogRoute(endpoint, rpc string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			if f := logFieldsFrom(req.Context()); f != nil {
+				f.mu.Lock()
+				f.route, f.rpc = endpoint, rpc
+				f.mu.Unlock()
+			}
+			next(respWtr, req)
+		}
+	}
+}
+
+// LogUnaryClientInterceptor adds the code and latency of the backend call to
+// the log events of the request making it.
+func LogUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if f := logFieldsFrom(ctx); f != nil {
+		f.mu.Lock()
+		f.grpcCode, f.latency = status.Code(err).String(), time.Since(start)
+		f.mu.Unlock()
+	}
+	return err
+}
+
+// RequestLogger returns a Logger adding the attributes of the request of ctx,
+// such as its request ID, route and backend call outcome, to every event. It
+// returns logger itself when ctx is not a request context.
+func RequestLogger(ctx context.Context, logger Logger) Logger {
+	f := logFieldsFrom(ctx)
+	if f == nil {
+		return logger
+	}
+	return &requestLogger{ctx: ctx, handler: NewLogHandler(logger), fields: f}
+}
+
+type requestLogger struct {
+	ctx     context.Context
+	handler slog.Handler
+	fields  *logFields
+}
+
+func (l *requestLogger) Debug(v ...interface{})    { l.log(slog.LevelDebug, v) }
+func (l *requestLogger) Info(v ...interface{})     { l.log(slog.LevelInfo, v) }
+func (l *requestLogger) Warning(v ...interface{})  { l.log(slog.LevelWarn, v) }
+func (l *requestLogger) Error(v ...interface{})    { l.log(slog.LevelError, v) }
+func (l *requestLogger) Critical(v ...interface{}) { l.log(LevelCritical, v) }
+func (l *requestLogger) Fatal(v ...interface{})    { l.log(LevelFatal, v) }
+
+func (l *requestLogger) log(level slog.Level, v []interface{}) {
+	if !l.handler.Enabled(l.ctx, level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, fmt.Sprint(v...), 0)
+	r.AddAttrs(l.fields.attrs()...)
+	_ = l.handler.Handle(l.ctx, r)
+}
+
+// Levels above slog.LevelError, matching the Critical and Fatal methods of Logger.
+const (
+	LevelCritical = slog.LevelError + 4
+	LevelFatal    = slog.LevelError + 8
+)
+
+// NewLogHandler returns a slog.Handler writing to logger, such as the KrakenD
+// logger received by RegisterLogger. Attributes are appended to the message
+// as key=value pairs. A Logger created by NewSlogLogger is unwrapped to its
+// own handler instead.
+func NewLogHandler(logger Logger) slog.Handler {
+	if l, ok := logger.(*slogLogger); ok {
+		return l.logger.Handler()
+	}
+	return &logHandler{logger: logger}
+}
+
+type logHandler struct {
+	logger Logger
+	attrs  []slog.Attr
+	group  string
+}
+
+func (h *logHandler) Enabled(context.Context, slog.Level) bool {
+	// the Logger filters levels itself
+	return true
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var msg strings.Builder
+	msg.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(&msg, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&msg, h.group, a)
+		return true
+	})
+
+	switch {
+	case r.Level >= LevelFatal:
+		h.logger.Fatal(msg.String())
+	case r.Level >= LevelCritical:
+		h.logger.Critical(msg.String())
+	case r.Level >= slog.LevelError:
+		h.logger.Error(msg.String())
+	case r.Level >= slog.LevelWarn:
+		h.logger.Warning(msg.String())
+	case r.Level >= slog.LevelInfo:
+		h.logger.Info(msg.String())
+	default:
+		h.logger.Debug(msg.String())
+	}
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	prefixed = append(prefixed, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		prefixed = append(prefixed, a)
+	}
+	return &logHandler{logger: h.logger, attrs: prefixed, group: h.group}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &logHandler{logger: h.logger, attrs: h.attrs, group: group}
+}
+
+func writeAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, key, ga)
+		}
+		return
+	}
+	b.WriteByte(' ')
+	b.WriteString(key)
+	b.WriteByte('=')
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
+
+// NewSlogLogger returns a Logger writing to logger, used when KrakenD did
+// not register its own.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Debug(v ...interface{})   { l.logger.Debug(fmt.Sprint(v...)) }
+func (l *slogLogger) Info(v ...interface{})    { l.logger.Info(fmt.Sprint(v...)) }
+func (l *slogLogger) Warning(v ...interface{}) { l.logger.Warn(fmt.Sprint(v...)) }
+func (l *slogLogger) Error(v ...interface{})   { l.logger.Error(fmt.Sprint(v...)) }
+func (l *slogLogger) Critical(v ...interface{}) {
+	l.logger.Log(context.Background(), LevelCritical, fmt.Sprint(v...))
+}
+func (l *slogLogger) Fatal(v ...interface{}) {
+	l.logger.Log(context.Background(), LevelFatal, fmt.Sprint(v...))
+}
@@ -0,0 +1,61 @@
+package wrapper_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogging(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+
+	t.Run("should bridge slog into the Logger", func(t *testing.T) {
+		mockedLogger.EXPECT().Warning(`backend slow component=auth call.rpc=GetAppGroup call.note="took too long"`)
+		mockedLogger.EXPECT().Critical("backend gone component=auth")
+
+		log := slog.New(wrapper.NewLogHandler(mockedLogger)).With("component", "auth").WithGroup("call")
+		log.Warn("backend slow", "rpc", "GetAppGroup", "note", "took too long")
+		log.Log(context.Background(), wrapper.LevelCritical, "backend gone")
+	})
+
+	t.Run("should attach the request fields to every event", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := wrapper.NewSlogLogger(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey || a.Key == "latency" {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})))
+
+		invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+			return status.Error(codes.NotFound, "no such app group")
+		}
+		handler := wrapper.RequestID(wrapper.LogRoute("/v1/app-groups/{id}", "GetAppGroup")(func(w http.ResponseWriter, req *http.Request) {
+			_ = wrapper.LogUnaryClientInterceptor(req.Context(), "/grpc.AuthService/GetAppGroup", nil, nil, nil, invoker)
+			wrapper.RequestLogger(req.Context(), logger).Error("error while making grpc call: ", "not found")
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+		handler(httptest.NewRecorder(), req)
+
+		assert.Equal(t, `level=ERROR msg="error while making grpc call: not found" request_id=req-1 client_ip=203.0.113.7 route=/v1/app-groups/{id} rpc=GetAppGroup grpc_code=NotFound`+"\n", out.String())
+	})
+}
@@ -0,0 +1,219 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsConfig exposes Prometheus metrics of the routes and backend calls.
+type MetricsConfig struct {
+	// Path serves the metrics in the Prometheus text format, empty to only
+	// register them.
+	Path string `json:"path"`
+	// Registry is "plugin" for a registry of the plugin, or "default" for the
+	// process default registry, exposed along the KrakenD metrics by its
+	// Prometheus exporter.
+	Registry  string `json:"registry"`
+	Namespace string `json:"namespace"`
+	// Buckets are the upper bounds of the latency histograms, in seconds.
+	Buckets []float64 `json:"buckets"`
+}
+
+func (c *MetricsConfig) setDefaults() {
+	*c = MetricsConfig{
+		Path:      "/__metrics",
+		Registry:  "plugin",
+		Namespace: "krakend_grpc_proxy",
+		Buckets:   prometheus.DefBuckets,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c MetricsConfig) Validate(key string) error {
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return &ConfigError{Key: joinKey(key, "path"), Err: errors.New("must start with /")}
+	}
+	if c.Registry != "plugin" && c.Registry != "default" {
+		return &ConfigError{Key: joinKey(key, "registry"), Err: fmt.Errorf("unsupported registry %q", c.Registry)}
+	}
+	if len(c.Buckets) == 0 {
+		return &ConfigError{Key: joinKey(key, "buckets"), Err: errors.New("must not be empty")}
+	}
+	for i := 1; i < len(c.Buckets); i++ {
+		if c.Buckets[i] <= c.Buckets[i-1] {
+			return &ConfigError{Key: joinKey(key, "buckets"), Err: errors.New("must be increasing")}
+		}
+	}
+	return nil
+}
+
+// sizeBuckets cover bodies from 64B to 4MiB, the default grpc message limit.
+var sizeBuckets = prometheus.ExponentialBuckets(64, 4, 9)
+
+type metrics struct {
+	cfg      MetricsConfig
+	gatherer prometheus.Gatherer
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight *prometheus.GaugeVec
+	requestSize      *prometheus.HistogramVec
+	responseSize     *prometheus.HistogramVec
+
+	calls         *prometheus.CounterVec
+	callDuration  *prometheus.HistogramVec
+	callsInFlight *prometheus.GaugeVec
+	hedged        *prometheus.CounterVec
+}
+
+// registeredMetrics are the metrics NewMetrics last registered, by
+// registerer.
+var registeredMetrics = struct {
+	sync.Mutex
+	byRegisterer map[prometheus.Registerer]*metrics
+}{byRegisterer: make(map[prometheus.Registerer]*metrics)}
+
+// NewMetrics registers the metrics into reg and serves the ones of gatherer.
+// The metrics registered by a previous config with the same namespace and
+// buckets are reused, so that a reload does not reset them; those of
+// another config are unregistered and replaced. Labels only take route
+// templates, RPC names and status codes, keeping their cardinality bounded.
+func NewMetrics(cfg MetricsConfig, reg prometheus.Registerer, gatherer prometheus.Gatherer) (*metrics, error) {
+	registeredMetrics.Lock()
+	defer registeredMetrics.Unlock()
+	if prev := registeredMetrics.byRegisterer[reg]; prev != nil {
+		if prev.cfg.Namespace == cfg.Namespace && slices.Equal(prev.cfg.Buckets, cfg.Buckets) {
+			m := *prev
+			m.cfg, m.gatherer = cfg, gatherer
+			return &m, nil
+		}
+		// histograms cannot change their buckets, so a new config starts
+		// its metrics over
+		for _, c := range prev.collectors() {
+			reg.Unregister(c)
+		}
+		delete(registeredMetrics.byRegisterer, reg)
+	}
+
+	m := &metrics{cfg: cfg, gatherer: gatherer}
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.Namespace, Name: "http_requests_total",
+		Help: "Requests served by the wrapper routes.",
+	}, []string{"route", "method", "status"})
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.Namespace, Name: "http_request_duration_seconds",
+		Help: "Latency of the requests served by the wrapper routes.", Buckets: cfg.Buckets,
+	}, []string{"route", "method", "status"})
+	m.requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: cfg.Namespace, Name: "http_requests_in_flight",
+		Help: "Requests being served by the wrapper routes.",
+	}, []string{"route", "method"})
+	m.requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.Namespace, Name: "http_request_size_bytes",
+		Help: "Body size of the requests with a known content length.", Buckets: sizeBuckets,
+	}, []string{"route", "method"})
+	m.responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.Namespace, Name: "http_response_size_bytes",
+		Help: "Body size of the responses.", Buckets: sizeBuckets,
+	}, []string{"route", "method"})
+	m.calls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.Namespace, Name: "grpc_client_calls_total",
+		Help: "Calls sent to the backend.",
+	}, []string{"rpc", "code"})
+	m.callDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.Namespace, Name: "grpc_client_call_duration_seconds",
+		Help: "Latency of the calls sent to the backend.", Buckets: cfg.Buckets,
+	}, []string{"rpc", "code"})
+	m.callsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: cfg.Namespace, Name: "grpc_client_calls_in_flight",
+		Help: "Calls to the backend waiting for their response.",
+	}, []string{"rpc"})
+	m.hedged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.Namespace, Name: "hedged_requests_total",
+		Help: "Extra attempts sent by hedged calls.",
+	}, []string{"rpc"})
+
+	var registered []prometheus.Collector
+	for _, c := range m.collectors() {
+		if err := reg.Register(c); err != nil {
+			for _, r := range registered {
+				reg.Unregister(r)
+			}
+			return nil, fmt.Errorf("unable to register metrics: %w", err)
+		}
+		registered = append(registered, c)
+	}
+	registeredMetrics.byRegisterer[reg] = m
+	return m, nil
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requests, m.requestDuration, m.requestsInFlight, m.requestSize, m.responseSize,
+		m.calls, m.callDuration, m.callsInFlight, m.hedged,
+	}
+}
+
+// Params returns the wrapper param registering the metrics route, if any.
+func (m *metrics) Params() []WrapperParam {
+	if m.cfg.Path == "" {
+		return nil
+	}
+	return []WrapperParam{{Endpoint: m.cfg.Path, Method: "GET", Handler: promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{}).ServeHTTP}}
+}
+
+// Middleware measures the requests of the route endpoint.
+func (m *metrics) Middleware(endpoint string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			inFlight := m.requestsInFlight.WithLabelValues(endpoint, req.Method)
+			inFlight.Inc()
+			defer inFlight.Dec()
+			if req.ContentLength >= 0 {
+				m.requestSize.WithLabelValues(endpoint, req.Method).Observe(float64(req.ContentLength))
+			}
+
+			start := time.Now()
+			w := &statusWriter{ResponseWriter: respWtr}
+			next(w, req)
+
+			code := strconv.Itoa(w.Status())
+			m.requests.WithLabelValues(endpoint, req.Method, code).Inc()
+			m.requestDuration.WithLabelValues(endpoint, req.Method, code).Observe(time.Since(start).Seconds())
+			m.responseSize.WithLabelValues(endpoint, req.Method).Observe(float64(w.size))
+		}
+	}
+}
+
+// UnaryClientInterceptor measures the calls sent to the backend, use it last
+// in the chain so that coalesced and shed calls are not counted.
+func (m *metrics) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	inFlight := m.callsInFlight.WithLabelValues(method)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	code := status.Code(err).String()
+	m.calls.WithLabelValues(method, code).Inc()
+	m.callDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Hedged counts an extra attempt of a hedged call to method, pass it to
+// NewHedger.
+func (m *metrics) Hedged(method string) {
+	m.hedged.WithLabelValues(method).Inc()
+}
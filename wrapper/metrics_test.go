@@ -0,0 +1,100 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cfg := wrapper.MetricsConfig{Path: "/__metrics", Registry: "plugin", Namespace: "test", Buckets: prometheus.DefBuckets}
+	metrics, err := wrapper.NewMetrics(cfg, reg, reg)
+	require.NoError(t, err)
+
+	invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "no such app group")
+	}
+	handler := metrics.Middleware("/v1/app-groups/{id}")(func(w http.ResponseWriter, req *http.Request) {
+		_ = metrics.UnaryClientInterceptor(req.Context(), "/grpc.AuthService/GetAppGroup", nil, nil, nil, invoker)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"Internal Server Error"}`))
+	})
+	for _, id := range []string{"appgrp123", "appgrp456"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/app-groups/"+id, nil))
+	}
+
+	t.Run("should label requests by route template", func(t *testing.T) {
+		expected := `
+# HELP test_http_requests_total Requests served by the wrapper routes.
+# TYPE test_http_requests_total counter
+test_http_requests_total{method="GET",route="/v1/app-groups/{id}",status="500"} 2
+`
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "test_http_requests_total"))
+	})
+
+	t.Run("should label calls by rpc and code", func(t *testing.T) {
+		expected := `
+# HELP test_grpc_client_calls_total Calls sent to the backend.
+# TYPE test_grpc_client_calls_total counter
+test_grpc_client_calls_total{code="NotFound",rpc="/grpc.AuthService/GetAppGroup"} 2
+`
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "test_grpc_client_calls_total"))
+	})
+
+	t.Run("should count hedged attempts by rpc", func(t *testing.T) {
+		metrics.Hedged("/grpc.AuthService/GetAppGroup")
+		expected := `
+# HELP test_hedged_requests_total Extra attempts sent by hedged calls.
+# TYPE test_hedged_requests_total counter
+test_hedged_requests_total{rpc="/grpc.AuthService/GetAppGroup"} 1
+`
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "test_hedged_requests_total"))
+	})
+
+	t.Run("should keep the metrics of a previous config", func(t *testing.T) {
+		reloaded, err := wrapper.NewMetrics(cfg, reg, reg)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		reloaded.Params()[0].Handler(w, httptest.NewRequest(http.MethodGet, "/__metrics", nil))
+		assert.Contains(t, w.Body.String(), `test_http_response_size_bytes_sum{method="GET",route="/v1/app-groups/{id}"} 66`)
+		assert.Contains(t, w.Body.String(), `test_http_requests_in_flight{method="GET",route="/v1/app-groups/{id}"} 0`)
+	})
+
+	t.Run("should replace the metrics of a config with other buckets", func(t *testing.T) {
+		changed := cfg
+		changed.Namespace = "changed"
+		changed.Buckets = []float64{0.5, 1}
+		reloaded, err := wrapper.NewMetrics(changed, reg, reg)
+		require.NoError(t, err)
+		reloaded.Middleware("/v1/app-groups/{id}")(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil))
+
+		w := httptest.NewRecorder()
+		reloaded.Params()[0].Handler(w, httptest.NewRequest(http.MethodGet, "/__metrics", nil))
+		assert.Contains(t, w.Body.String(), `changed_http_request_duration_seconds_bucket{method="GET",route="/v1/app-groups/{id}",status="200",le="0.5"} 1`)
+		assert.NotContains(t, w.Body.String(), "test_http_requests_total")
+	})
+
+	t.Run("should reject metrics registered by someone else", func(t *testing.T) {
+		other := prometheus.NewRegistry()
+		other.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "test", Name: "http_requests_total", Help: "Requests served by the wrapper routes.",
+		}, []string{"route", "method", "status"}))
+		_, err := wrapper.NewMetrics(cfg, other, other)
+		assert.Error(t, err)
+	})
+}
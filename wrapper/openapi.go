@@ -0,0 +1,390 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// requestBinding describes how a handler reads its request: the body fields
+// it decodes, mapped to the fields of the rpc input message they fill. Path
+// params fill the input fields of the same name.
+type requestBinding struct {
+	ContentType string
+	Fields      map[string]string
+}
+
+// requestBindings must be kept in line with the handlers.
+var requestBindings = map[string]requestBinding{
+	"UserToken":      {ContentType: "application/x-www-form-urlencoded", Fields: map[string]string{"email": "email", "password": "password"}},
+	"CreateUser":     {ContentType: "application/json", Fields: map[string]string{"email": "email", "password": "password", "org_id": "org_id", "app_grp_id": "app_group_id"}},
+	"CreateApp":      {ContentType: "application/json", Fields: map[string]string{"org_id": "org_id", "app_group_id": "app_group_id"}},
+	"CreateAppGroup": {ContentType: "application/json", Fields: map[string]string{"name": "name", "scopes": "scopes", "org_id": "org_id"}},
+	"GetAppGroup":    {},
+	"UpdateAppGroup": {ContentType: "application/json", Fields: map[string]string{"name": "name", "scopes": "scopes", "org_id": "org_id"}},
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document.
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*JSONSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+// JSONSchema is the subset of JSON Schema describing the proto messages.
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+}
+
+// schemaStyle is how a route encodes its messages in JSON.
+type schemaStyle int
+
+const (
+	// structJSON is encoding/json on the generated structs, as the handlers
+	// of the plugin encode them.
+	structJSON schemaStyle = iota
+	// protoJSON is protojson with the proto field names, as the transcoder
+	// encodes them.
+	protoJSON
+)
+
+// schemaSet holds the components of a document. A message described in
+// both styles gets a second component, suffixed with the style.
+type schemaSet struct {
+	schemas map[string]*JSONSchema
+	names   map[schemaKey]string
+}
+
+type schemaKey struct {
+	message protoreflect.FullName
+	style   schemaStyle
+}
+
+// openAPIVersion is the version of the documented API.
+const openAPIVersion = "1.0.0"
+
+// errorSchema is the body RequestID gives to error responses.
+const errorSchema = "Error"
+
+// OpenAPI describes routes served by the rpcs of service. The request and
+// response schemas come from the rpc messages, as encoded by the handlers or,
+// for the routes bound by an HTTPRule, by the transcoder.
+func OpenAPI(routes []RouteConfig, service protoreflect.ServiceDescriptor) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: string(service.FullName()), Version: openAPIVersion},
+		Paths:   make(map[string]map[string]*openAPIOperation, len(routes)),
+	}
+	doc.Components.Schemas = map[string]*JSONSchema{
+		errorSchema: {Type: "object", Properties: map[string]*JSONSchema{
+			"error":      {Type: "string"},
+			"request_id": {Type: "string"},
+		}},
+	}
+	set := &schemaSet{schemas: doc.Components.Schemas, names: make(map[schemaKey]string)}
+	operationIDs := make(map[string]bool, len(routes))
+
+	for i, route := range routes {
+		var method protoreflect.MethodDescriptor
+		var binding requestBinding
+		style := structJSON
+		if route.HTTPRule != nil {
+			method = route.HTTPRule.Method
+			style = protoJSON
+		} else {
+			var ok bool
+			method = service.Methods().ByName(protoreflect.Name(route.RPC))
+			binding, ok = requestBindings[route.RPC]
+			if method == nil || !ok {
+				return nil, &ConfigError{Key: fmt.Sprintf("routes[%d].rpc", i), Err: fmt.Errorf("no handler for rpc %q", route.RPC)}
+			}
+		}
+		input := method.Input().Fields()
+
+		op := &openAPIOperation{OperationID: operationID(route, operationIDs), Responses: errorResponses(route)}
+		for _, segment := range strings.Split(route.Endpoint, "/") {
+			name, ok := strings.CutPrefix(segment, "{")
+			if !ok {
+				continue
+			}
+			name = strings.TrimSuffix(name, "}")
+			schema := &JSONSchema{Type: "string"}
+			if fd, err := fieldByPath(method.Input(), name); err == nil {
+				schema = set.fieldSchema(fd, style)
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+		}
+		if route.HTTPRule != nil {
+			annotatedRequest(op, route.HTTPRule, set)
+		} else if len(binding.Fields) > 0 {
+			body := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema, len(binding.Fields))}
+			for name, field := range binding.Fields {
+				fd := input.ByName(protoreflect.Name(field))
+				if fd == nil {
+					return nil, fmt.Errorf("rpc %s has no input field %q", route.RPC, field)
+				}
+				body.Properties[name] = set.fieldSchema(fd, style)
+			}
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{binding.ContentType: {Schema: body}}}
+		}
+		response := set.messageSchema(method.Output(), style)
+		if route.HTTPRule != nil && route.HTTPRule.ResponseBody != "" {
+			fd, _ := fieldByPath(method.Output(), route.HTTPRule.ResponseBody)
+			response = set.fieldSchema(fd, style)
+		}
+		op.Responses["200"] = &openAPIResponse{
+			Description: "OK",
+			Content:     map[string]openAPIMediaType{"application/json": {Schema: response}},
+		}
+
+		if doc.Paths[route.Endpoint] == nil {
+			doc.Paths[route.Endpoint] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[route.Endpoint][strings.ToLower(route.Method)] = op
+	}
+	return doc, nil
+}
+
+// operationID returns the RPC of route, or the full method name for the
+// routes bound by an HTTPRule, suffixed with a counter when another route of
+// the document already uses it.
+func operationID(route RouteConfig, seen map[string]bool) string {
+	id := route.RPC
+	if route.HTTPRule != nil {
+		id = string(route.HTTPRule.Method.FullName())
+	}
+	unique := id
+	for n := 2; seen[unique]; n++ {
+		unique = fmt.Sprintf("%s_%d", id, n)
+	}
+	seen[unique] = true
+	return unique
+}
+
+// annotatedRequest describes the body and query params of a route bound by
+// a google.api.http annotation.
+func annotatedRequest(op *openAPIOperation, rule *HTTPRule, set *schemaSet) {
+	input := rule.Method.Input()
+	switch rule.Body {
+	case "":
+	case "*":
+		op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{"application/json": {Schema: set.messageSchema(input, protoJSON)}}}
+		return
+	default:
+		fd, _ := fieldByPath(input, rule.Body)
+		op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{"application/json": {Schema: set.fieldSchema(fd, protoJSON)}}}
+	}
+	// the top level scalar fields left are bound to query params
+	for i := range input.Fields().Len() {
+		fd := input.Fields().Get(i)
+		name := string(fd.Name())
+		if name == rule.Body || slices.Contains(rule.PathParams, name) || fd.Kind() == protoreflect.MessageKind || fd.IsMap() {
+			continue
+		}
+		op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "query", Schema: set.fieldSchema(fd, protoJSON)})
+	}
+}
+
+// errorResponses lists the error statuses the handlers and the route
+// middlewares answer.
+func errorResponses(route RouteConfig) map[string]*openAPIResponse {
+	responses := map[string]*openAPIResponse{
+		"400": {Description: "the request could not be decoded"},
+		"413": {Description: "the request is over the size limit of the auth service"},
+		"500": {Description: "the auth service failed"},
+		"502": {Description: "the response is over the size limit, or the auth service is out of resources"},
+		"503": {Description: "the auth service is unavailable or overloaded"},
+	}
+	// the conditional requests of the app group handlers
+	switch {
+	case route.HTTPRule != nil:
+	case route.RPC == "GetAppGroup":
+		responses["304"] = &openAPIResponse{Description: "the app group matches If-None-Match"}
+	case route.RPC == "UpdateAppGroup":
+		responses["412"] = &openAPIResponse{Description: "the app group does not match If-Match"}
+	}
+	if route.Idempotency != nil {
+		responses["409"] = &openAPIResponse{Description: "a request with the same Idempotency-Key is in flight"}
+		responses["422"] = &openAPIResponse{Description: "the Idempotency-Key was used for another request"}
+	}
+	for status, resp := range responses {
+		if status[0] != '3' {
+			resp.Content = map[string]openAPIMediaType{"application/json": {Schema: &JSONSchema{Ref: "#/components/schemas/" + errorSchema}}}
+		}
+	}
+	return responses
+}
+
+// messageSchema adds the schema of md to the components and returns a
+// reference to it. Fields are named and typed as style encodes them.
+func (set *schemaSet) messageSchema(md protoreflect.MessageDescriptor, style schemaStyle) *JSONSchema {
+	if style == protoJSON {
+		if schema, ok := wellKnownSchema(md); ok {
+			return schema
+		}
+	}
+	key := schemaKey{message: md.FullName(), style: style}
+	if name, ok := set.names[key]; ok {
+		return &JSONSchema{Ref: "#/components/schemas/" + name}
+	}
+	name := string(md.FullName())
+	if _, taken := set.schemas[name]; taken {
+		name += map[schemaStyle]string{structJSON: "_struct", protoJSON: "_protojson"}[style]
+	}
+	schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema, md.Fields().Len())}
+	// registered before the fields, for recursive messages
+	set.names[key] = name
+	set.schemas[name] = schema
+	for i := range md.Fields().Len() {
+		fd := md.Fields().Get(i)
+		schema.Properties[string(fd.Name())] = set.fieldSchema(fd, style)
+	}
+	return &JSONSchema{Ref: "#/components/schemas/" + name}
+}
+
+func (set *schemaSet) fieldSchema(fd protoreflect.FieldDescriptor, style schemaStyle) *JSONSchema {
+	if fd.IsMap() {
+		return &JSONSchema{Type: "object", AdditionalProperties: set.singularSchema(fd.MapValue(), style)}
+	}
+	if fd.IsList() {
+		return &JSONSchema{Type: "array", Items: set.singularSchema(fd, style)}
+	}
+	return set.singularSchema(fd, style)
+}
+
+func (set *schemaSet) singularSchema(fd protoreflect.FieldDescriptor, style schemaStyle) *JSONSchema {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return &JSONSchema{Type: "boolean"}
+	case protoreflect.EnumKind:
+		if style != protoJSON {
+			return &JSONSchema{Type: "integer", Format: "int32"}
+		}
+		// protojson writes enums by name, and NullValue as null
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return &JSONSchema{Type: "null"}
+		}
+		values := fd.Enum().Values()
+		schema := &JSONSchema{Type: "string", Enum: make([]string, 0, values.Len())}
+		for i := range values.Len() {
+			schema.Enum = append(schema.Enum, string(values.Get(i).Name()))
+		}
+		return schema
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &JSONSchema{Type: "integer", Format: "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// protojson writes 64 bit integers as strings, not to lose precision
+		// in JavaScript clients
+		if style == protoJSON {
+			return &JSONSchema{Type: "string", Format: "int64"}
+		}
+		return &JSONSchema{Type: "integer", Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if style == protoJSON {
+			return &JSONSchema{Type: "string", Format: "uint64"}
+		}
+		return &JSONSchema{Type: "integer", Format: "int64"}
+	case protoreflect.FloatKind:
+		return &JSONSchema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &JSONSchema{Type: "number", Format: "double"}
+	case protoreflect.BytesKind:
+		return &JSONSchema{Type: "string", Format: "byte"}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return set.messageSchema(fd.Message(), style)
+	default:
+		return &JSONSchema{Type: "string"}
+	}
+}
+
+// wellKnownSchema returns the schema of the well-known types protojson
+// encodes specially.
+func wellKnownSchema(md protoreflect.MessageDescriptor) (*JSONSchema, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return &JSONSchema{Type: "string", Format: "date-time"}, true
+	case "google.protobuf.Duration", "google.protobuf.FieldMask", "google.protobuf.StringValue":
+		return &JSONSchema{Type: "string"}, true
+	case "google.protobuf.Struct", "google.protobuf.Empty":
+		return &JSONSchema{Type: "object"}, true
+	case "google.protobuf.Any":
+		return &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{"@type": {Type: "string"}}}, true
+	case "google.protobuf.ListValue":
+		return &JSONSchema{Type: "array"}, true
+	case "google.protobuf.Value":
+		return &JSONSchema{}, true
+	case "google.protobuf.BoolValue":
+		return &JSONSchema{Type: "boolean"}, true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return &JSONSchema{Type: "integer", Format: "int32"}, true
+	case "google.protobuf.Int64Value":
+		return &JSONSchema{Type: "string", Format: "int64"}, true
+	case "google.protobuf.UInt64Value":
+		return &JSONSchema{Type: "string", Format: "uint64"}, true
+	case "google.protobuf.FloatValue":
+		return &JSONSchema{Type: "number", Format: "float"}, true
+	case "google.protobuf.DoubleValue":
+		return &JSONSchema{Type: "number", Format: "double"}, true
+	case "google.protobuf.BytesValue":
+		return &JSONSchema{Type: "string", Format: "byte"}, true
+	default:
+		return nil, false
+	}
+}
+
+// OpenAPIParams serves doc as JSON at path.
+func OpenAPIParams(path string, doc *OpenAPIDocument) []WrapperParam {
+	b, _ := json.MarshalIndent(doc, "", "  ")
+	return []WrapperParam{{Endpoint: path, Method: "GET", Handler: func(respWtr http.ResponseWriter, req *http.Request) {
+		respWtr.Header().Set("Content-Type", "application/json")
+		respWtr.WriteHeader(http.StatusOK)
+		_, _ = respWtr.Write(b)
+	}}}
+}
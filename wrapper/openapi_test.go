@@ -0,0 +1,73 @@
+package wrapper_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+)
+
+func TestOpenAPI(t *testing.T) {
+	service := client.File_service_proto.Services().ByName("AuthService")
+
+	t.Run("should describe the default routes", func(t *testing.T) {
+		doc, err := wrapper.OpenAPI(wrapper.DefaultRoutes(), service)
+		require.NoError(t, err)
+
+		// compare through JSON, as served
+		handler := wrapper.OpenAPIParams("/v1/openapi.json", doc)[0]
+		assert.Equal(t, "/v1/openapi.json", handler.Endpoint)
+		w := httptest.NewRecorder()
+		handler.Handler(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var served map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+		assert.Equal(t, "3.1.0", served["openapi"])
+		paths := served["paths"].(map[string]interface{})
+		assert.Len(t, paths, 5)
+
+		token := paths["/v1/users/token"].(map[string]interface{})["post"].(map[string]interface{})
+		assert.Contains(t, token["requestBody"].(map[string]interface{})["content"], "application/x-www-form-urlencoded")
+
+		createUser, _ := json.Marshal(paths["/v1/users"].(map[string]interface{})["post"].(map[string]interface{})["requestBody"])
+		assert.JSONEq(t, `{"required":true,"content":{"application/json":{"schema":{"type":"object","properties":{
+			"email":{"type":"string"},"password":{"type":"string"},"org_id":{"type":"string"},"app_grp_id":{"type":"string"}
+		}}}}}`, string(createUser))
+
+		appGroup := paths["/v1/app-groups/{id}"].(map[string]interface{})
+		get, _ := json.Marshal(appGroup["get"].(map[string]interface{})["parameters"])
+		assert.JSONEq(t, `[{"name":"id","in":"path","required":true,"schema":{"type":"string"}}]`, string(get))
+		assert.Contains(t, appGroup["get"].(map[string]interface{})["responses"], "304")
+		assert.Contains(t, appGroup["put"].(map[string]interface{})["responses"], "412")
+		assert.Contains(t, appGroup["put"].(map[string]interface{})["responses"], "503")
+
+		schemas, _ := json.Marshal(served["components"].(map[string]interface{})["schemas"].(map[string]interface{})["grpc.AppGroupResponse"])
+		assert.JSONEq(t, `{"type":"object","properties":{
+			"id":{"type":"string"},"org_id":{"type":"string"},"name":{"type":"string"},"scopes":{"type":"array","items":{"type":"string"}}
+		}}`, string(schemas))
+	})
+
+	t.Run("should list the idempotency errors", func(t *testing.T) {
+		doc, err := wrapper.OpenAPI([]wrapper.RouteConfig{
+			{Endpoint: "/v1/apps", Method: "POST", RPC: "CreateApp", Idempotency: &wrapper.IdempotencyConfig{}},
+		}, service)
+		require.NoError(t, err)
+		b, _ := json.Marshal(doc.Paths["/v1/apps"]["post"])
+		assert.Contains(t, string(b), `"409"`)
+		assert.Contains(t, string(b), `"422"`)
+	})
+
+	t.Run("should reject unknown rpcs", func(t *testing.T) {
+		_, err := wrapper.OpenAPI([]wrapper.RouteConfig{{Endpoint: "/v1/orgs", Method: "POST", RPC: "CreateOrg"}}, service)
+		var cfgErr *wrapper.ConfigError
+		require.True(t, errors.As(err, &cfgErr))
+		assert.Equal(t, "routes[0].rpc", cfgErr.Key)
+	})
+}
@@ -0,0 +1,233 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ConnectionConfig tunes the grpc connections to the backend. Zero values
+// keep the grpc defaults.
+type ConnectionConfig struct {
+	// KeepaliveTime is the idle time after which the client pings the backend, 0 disables pings.
+	KeepaliveTime Duration `json:"keepalive_time"`
+	// KeepaliveTimeout is how long to wait for a ping ack before closing the connection.
+	KeepaliveTimeout Duration `json:"keepalive_timeout"`
+	// KeepalivePermitWithoutStream sends pings even when no RPC is running.
+	KeepalivePermitWithoutStream bool `json:"keepalive_permit_without_stream"`
+	// MaxSendMsgSize and MaxRecvMsgSize are in bytes. Requests over the send
+	// limit answer 413 without reaching the backend, responses over the
+	// receive limit answer 502.
+	MaxSendMsgSize int `json:"max_send_msg_size"`
+	MaxRecvMsgSize int `json:"max_recv_msg_size"`
+	// Compression is the compressor used towards the backend, "gzip" or empty for none.
+	Compression string `json:"compression"`
+	// InitialWindowSize and InitialConnWindowSize are the HTTP/2 flow control
+	// windows per stream and per connection, in bytes.
+	InitialWindowSize     int32 `json:"initial_window_size"`
+	InitialConnWindowSize int32 `json:"initial_conn_window_size"`
+	// PoolSize is the number of connections requests are spread across.
+	PoolSize int `json:"pool_size"`
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c ConnectionConfig) Validate(key string) error {
+	if c.KeepaliveTime < 0 {
+		return &ConfigError{Key: joinKey(key, "keepalive_time"), Err: errors.New("must not be negative")}
+	}
+	if c.KeepaliveTimeout < 0 {
+		return &ConfigError{Key: joinKey(key, "keepalive_timeout"), Err: errors.New("must not be negative")}
+	}
+	if c.MaxSendMsgSize < 0 {
+		return &ConfigError{Key: joinKey(key, "max_send_msg_size"), Err: errors.New("must not be negative")}
+	}
+	if c.MaxRecvMsgSize < 0 {
+		return &ConfigError{Key: joinKey(key, "max_recv_msg_size"), Err: errors.New("must not be negative")}
+	}
+	if c.Compression != "" && c.Compression != gzip.Name {
+		return &ConfigError{Key: joinKey(key, "compression"), Err: fmt.Errorf("unsupported compressor %q", c.Compression)}
+	}
+	// grpc ignores windows below 64KiB
+	if c.InitialWindowSize != 0 && c.InitialWindowSize < 64*1024 {
+		return &ConfigError{Key: joinKey(key, "initial_window_size"), Err: errors.New("must be at least 65536")}
+	}
+	if c.InitialConnWindowSize != 0 && c.InitialConnWindowSize < 64*1024 {
+		return &ConfigError{Key: joinKey(key, "initial_conn_window_size"), Err: errors.New("must be at least 65536")}
+	}
+	if c.PoolSize < 1 {
+		return &ConfigError{Key: joinKey(key, "pool_size"), Err: errors.New("must be at least 1")}
+	}
+	return nil
+}
+
+// DialOptions translates the config into grpc dial options.
+func (c ConnectionConfig) DialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Duration(c.KeepaliveTime),
+			Timeout:             time.Duration(c.KeepaliveTimeout),
+			PermitWithoutStream: c.KeepalivePermitWithoutStream,
+		}))
+	}
+
+	var callOpts []grpc.CallOption
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(sendLimitInterceptor(c.MaxSendMsgSize)))
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.Compression != "" {
+		callOpts = append(callOpts, grpc.UseCompressor(c.Compression))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+
+	if c.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(c.InitialWindowSize))
+	}
+	if c.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(c.InitialConnWindowSize))
+	}
+	return opts
+}
+
+// MessageTooLargeError rejects a request message over the send limit.
+type MessageTooLargeError struct {
+	Size, Max int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("request message larger than max (%d vs. %d)", e.Size, e.Max)
+}
+
+// GRPCStatus reports the error as ResourceExhausted, as grpc does.
+func (e *MessageTooLargeError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// sendLimitInterceptor rejects the requests over max bytes before they are
+// sent, so that they are told from the responses over the receive limit,
+// which grpc reports with the same code.
+func sendLimitInterceptor(max int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if m, ok := req.(proto.Message); ok {
+			if size := proto.Size(m); size > max {
+				return &MessageTooLargeError{Size: size, Max: max}
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// connPool spreads calls across several connections to the same target, so
+// that high traffic is not pinned to a single HTTP/2 connection.
+type connPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+// DialPool creates size connections to target.
+func DialPool(target string, size int, opts ...grpc.DialOption) (*connPool, error) {
+	p := &connPool{conns: make([]*grpc.ClientConn, 0, size)}
+	for range size {
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+// Conns returns the pooled connections.
+func (p *connPool) Conns() []*grpc.ClientConn {
+	return p.conns
+}
+
+// pick returns the next connection in round robin order, skipping the ones
+// in TRANSIENT_FAILURE unless all of them are.
+func (p *connPool) pick() *grpc.ClientConn {
+	start := p.next.Add(1)
+	for i := range uint64(len(p.conns)) {
+		conn := p.conns[(start+i)%uint64(len(p.conns))]
+		if conn.GetState() != connectivity.TransientFailure {
+			return conn
+		}
+	}
+	return p.conns[start%uint64(len(p.conns))]
+}
+
+// order returns n connections in round robin order, starting with the one
+// pick would return. Connections are repeated when n exceeds the pool size.
+func (p *connPool) order(n int) []*grpc.ClientConn {
+	first := p.pick()
+	start := 0
+	for i, conn := range p.conns {
+		if conn == first {
+			start = i
+		}
+	}
+	conns := make([]*grpc.ClientConn, 0, n)
+	for i := range n {
+		conns = append(conns, p.conns[(start+i)%len(p.conns)])
+	}
+	return conns
+}
+
+func (p *connPool) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	return p.pick().Invoke(ctx, method, args, reply, opts...)
+}
+
+func (p *connPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return p.pick().NewStream(ctx, desc, method, opts...)
+}
+
+// GetState returns the healthiest state among the pooled connections.
+func (p *connPool) GetState() connectivity.State {
+	best := connectivity.Shutdown
+	for _, conn := range p.conns {
+		state := conn.GetState()
+		if stateRank(state) < stateRank(best) {
+			best = state
+		}
+	}
+	return best
+}
+
+func stateRank(s connectivity.State) int {
+	switch s {
+	case connectivity.Ready:
+		return 0
+	case connectivity.Idle:
+		return 1
+	case connectivity.Connecting:
+		return 2
+	case connectivity.TransientFailure:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func (p *connPool) Close() error {
+	var errs []error
+	for _, conn := range p.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
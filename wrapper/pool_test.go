@@ -0,0 +1,81 @@
+package wrapper_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestConnPool(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	dialOptions := func(cfg wrapper.ConnectionConfig) []grpc.DialOption {
+		return append([]grpc.DialOption{
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}, cfg.DialOptions()...)
+	}
+
+	t.Run("should spread calls across connections", func(t *testing.T) {
+		pool, err := wrapper.DialPool("passthrough:///bufnet", 3, dialOptions(wrapper.ConnectionConfig{
+			KeepaliveTime: wrapper.Duration(time.Minute),
+			Compression:   "gzip",
+		})...)
+		require.NoError(t, err)
+		defer pool.Close()
+		hc := grpc_health_v1.NewHealthClient(pool)
+
+		for range 3 {
+			_, err := hc.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+		}
+		for _, conn := range pool.Conns() {
+			assert.Equal(t, connectivity.Ready, conn.GetState())
+		}
+		assert.Equal(t, connectivity.Ready, pool.GetState())
+	})
+
+	t.Run("should reject messages over the send limit", func(t *testing.T) {
+		pool, err := wrapper.DialPool("passthrough:///bufnet", 1, dialOptions(wrapper.ConnectionConfig{MaxSendMsgSize: 4})...)
+		require.NoError(t, err)
+		defer pool.Close()
+		hc := grpc_health_v1.NewHealthClient(pool)
+
+		_, err = hc.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "grpc.AuthService"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		var tooLarge *wrapper.MessageTooLargeError
+		assert.ErrorAs(t, err, &tooLarge)
+	})
+
+	t.Run("should tell responses over the receive limit from requests over the send limit", func(t *testing.T) {
+		pool, err := wrapper.DialPool("passthrough:///bufnet", 1, dialOptions(wrapper.ConnectionConfig{MaxSendMsgSize: 1024, MaxRecvMsgSize: 1})...)
+		require.NoError(t, err)
+		defer pool.Close()
+		hc := grpc_health_v1.NewHealthClient(pool)
+
+		_, err = hc.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		var tooLarge *wrapper.MessageTooLargeError
+		assert.False(t, errors.As(err, &tooLarge))
+	})
+}
@@ -0,0 +1,357 @@
+package wrapper
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RedactAction is what the redaction policy does with a sensitive value.
+type RedactAction string
+
+const (
+	// RedactMask replaces the value with [REDACTED].
+	RedactMask RedactAction = "mask"
+	// RedactHash replaces the value with a keyed hash, so that equal values
+	// can still be correlated.
+	RedactHash RedactAction = "hash"
+	// RedactDrop removes the value and its key.
+	RedactDrop RedactAction = "drop"
+)
+
+const redactedValue = "[REDACTED]"
+
+// RedactionConfig adds to the default redaction policy, which always masks
+// the password, access_token and refresh_token fields and the Authorization
+// header. Rules may pick another action for those but cannot disable them.
+type RedactionConfig struct {
+	// Fields are JSON field paths such as "user.email", a name without dot
+	// matching the field at any depth. They also apply to form values and
+	// to the key=value pairs of log messages.
+	Fields map[string]RedactAction `json:"fields"`
+	// Headers are HTTP header or grpc metadata names.
+	Headers map[string]RedactAction `json:"headers"`
+	// ProtoFields are field names of the backend messages, matched at any depth.
+	ProtoFields map[string]RedactAction `json:"proto_fields"`
+	// HashKey keys the hashes, a random key is used when empty so hashes only
+	// match within a process.
+	HashKey string `json:"hash_key"`
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c RedactionConfig) Validate(key string) error {
+	for _, rules := range []struct {
+		key   string
+		rules map[string]RedactAction
+	}{{"fields", c.Fields}, {"headers", c.Headers}, {"proto_fields", c.ProtoFields}} {
+		for name, action := range rules.rules {
+			if !slices.Contains([]RedactAction{RedactMask, RedactHash, RedactDrop}, action) {
+				return &ConfigError{Key: joinKey(joinKey(key, rules.key), name), Err: fmt.Errorf("unsupported action %q", action)}
+			}
+		}
+	}
+	return nil
+}
+
+// Redactor applies the redaction policy to the headers, bodies, messages and
+// log lines the plugin logs, traces or records.
+type Redactor struct {
+	fields      map[string]RedactAction
+	headers     map[string]RedactAction
+	protoFields map[string]RedactAction
+	hashKey     []byte
+	logPairs    *regexp.Regexp
+}
+
+// NewRedactor builds the default policy extended with cfg.
+func NewRedactor(cfg RedactionConfig) *Redactor {
+	r := &Redactor{
+		fields:      map[string]RedactAction{"password": RedactMask, "access_token": RedactMask, "refresh_token": RedactMask},
+		headers:     map[string]RedactAction{"Authorization": RedactMask},
+		protoFields: map[string]RedactAction{"password": RedactMask, "access_token": RedactMask, "refresh_token": RedactMask},
+		hashKey:     []byte(cfg.HashKey),
+	}
+	for name, action := range cfg.Fields {
+		r.fields[name] = action
+	}
+	for name, action := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = action
+	}
+	for name, action := range cfg.ProtoFields {
+		r.protoFields[name] = action
+	}
+	if len(r.hashKey) == 0 {
+		r.hashKey = make([]byte, 32)
+		_, _ = rand.Read(r.hashKey)
+	}
+
+	// key=value, key: value and "key":"value" pairs of log messages
+	names := make([]string, 0, len(r.fields)+len(r.headers))
+	for name := range r.fields {
+		names = append(names, regexp.QuoteMeta(name[strings.LastIndex(name, ".")+1:]))
+	}
+	for name := range r.headers {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	slices.Sort(names)
+	r.logPairs = regexp.MustCompile(`(?i)("?\b(?:` + strings.Join(slices.Compact(names), "|") + `)"?\s*[:=]\s*)("[^"]*"|(?:bearer |basic )?[^\s,&}]+)`)
+	return r
+}
+
+func (r *Redactor) apply(action RedactAction, value string) string {
+	if action == RedactHash {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+	return redactedValue
+}
+
+func (r *Redactor) fieldAction(path string) (RedactAction, bool) {
+	if action, ok := r.fields[path]; ok {
+		return action, true
+	}
+	// a name without dot matches the field at any depth
+	action, ok := r.fields[path[strings.LastIndex(path, ".")+1:]]
+	return action, ok
+}
+
+// Headers returns a copy of h with the sensitive values redacted.
+func (r *Redactor) Headers(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		action, ok := r.headers[http.CanonicalHeaderKey(name)]
+		switch {
+		case !ok:
+			out[name] = slices.Clone(values)
+		case action == RedactDrop:
+		default:
+			redacted := make([]string, len(values))
+			for i, v := range values {
+				redacted[i] = r.apply(action, v)
+			}
+			out[name] = redacted
+		}
+	}
+	return out
+}
+
+// JSON returns body with the sensitive fields redacted. Bodies that are not
+// JSON are redacted as form values.
+func (r *Redactor) JSON(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return []byte(redactedValue)
+		}
+		return []byte(r.Form(values).Encode())
+	}
+	b, _ := json.Marshal(r.redactJSON("", v))
+	return b
+}
+
+func (r *Redactor) redactJSON(path string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			childPath := joinKey(path, k)
+			if action, ok := r.fieldAction(childPath); ok {
+				if action == RedactDrop {
+					delete(v, k)
+				} else {
+					v[k] = r.apply(action, fmt.Sprint(child))
+				}
+				continue
+			}
+			v[k] = r.redactJSON(childPath, child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.redactJSON(path, child)
+		}
+	}
+	return v
+}
+
+// Form returns a copy of values with the sensitive fields redacted.
+func (r *Redactor) Form(values url.Values) url.Values {
+	out := make(url.Values, len(values))
+	for k, vs := range values {
+		action, ok := r.fieldAction(k)
+		switch {
+		case !ok:
+			out[k] = slices.Clone(vs)
+		case action == RedactDrop:
+		default:
+			out[k] = []string{r.apply(action, strings.Join(vs, ","))}
+		}
+	}
+	return out
+}
+
+// Proto returns a copy of msg with the sensitive fields redacted, cleared
+// when they are dropped or not strings.
+func (r *Redactor) Proto(msg proto.Message) proto.Message {
+	clone := proto.Clone(msg)
+	r.redactProto(clone.ProtoReflect())
+	return clone
+}
+
+func (r *Redactor) redactProto(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		action, ok := r.protoFields[string(fd.Name())]
+		if !ok {
+			action, ok = r.protoFields[fd.JSONName()]
+		}
+		switch {
+		case ok && action != RedactDrop && fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap():
+			m.Set(fd, protoreflect.ValueOfString(r.apply(action, v.String())))
+		case ok:
+			m.Clear(fd)
+		case fd.Kind() == protoreflect.MessageKind && fd.IsList():
+			for i := range v.List().Len() {
+				r.redactProto(v.List().Get(i).Message())
+			}
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsMap():
+			r.redactProto(v.Message())
+		}
+		return true
+	})
+}
+
+// String redacts the values of the sensitive key=value, key: value and
+// "key":"value" pairs found in s, such as a log message.
+func (r *Redactor) String(s string) string {
+	return r.logPairs.ReplaceAllStringFunc(s, func(pair string) string {
+		m := r.logPairs.FindStringSubmatch(pair)
+		key := strings.Trim(strings.TrimRight(m[1], ":= \t"), `"`)
+		action, ok := r.fields[key]
+		if !ok {
+			action = r.headers[http.CanonicalHeaderKey(key)]
+		}
+		if action == RedactDrop {
+			action = RedactMask
+		}
+		value := strings.Trim(m[2], `"`)
+		if strings.HasPrefix(m[2], `"`) {
+			return m[1] + `"` + r.apply(action, value) + `"`
+		}
+		return m[1] + r.apply(action, value)
+	})
+}
+
+// Attribute redacts a span attribute, matching header attributes such as
+// http.request.header.authorization against the header rules and the others
+// against the field rules by their last segment. Other string attributes,
+// such as error messages, are redacted as log messages.
+func (r *Redactor) Attribute(kv attribute.KeyValue) (attribute.KeyValue, bool) {
+	key := string(kv.Key)
+	var (
+		action RedactAction
+		ok     bool
+	)
+	if name, isHeader := strings.CutPrefix(key, "http.request.header."); isHeader {
+		action, ok = r.headers[http.CanonicalHeaderKey(name)]
+	} else {
+		action, ok = r.fields[key[strings.LastIndex(key, ".")+1:]]
+	}
+	switch {
+	case ok && action == RedactDrop:
+		return kv, false
+	case ok:
+		return attribute.String(key, r.apply(action, kv.Value.Emit())), true
+	case kv.Value.Type() == attribute.STRING:
+		return attribute.String(key, r.String(kv.Value.AsString())), true
+	default:
+		return kv, true
+	}
+}
+
+func (r *Redactor) attributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	redacted := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if kv, keep := r.Attribute(kv); keep {
+			redacted = append(redacted, kv)
+		}
+	}
+	return redacted
+}
+
+// RedactLogger returns a Logger redacting the messages it writes to logger.
+func RedactLogger(logger Logger, r *Redactor) Logger {
+	return &redactLogger{logger: logger, redactor: r}
+}
+
+type redactLogger struct {
+	logger   Logger
+	redactor *Redactor
+}
+
+func (l *redactLogger) Debug(v ...interface{}) { l.logger.Debug(l.redactor.String(fmt.Sprint(v...))) }
+func (l *redactLogger) Info(v ...interface{})  { l.logger.Info(l.redactor.String(fmt.Sprint(v...))) }
+func (l *redactLogger) Warning(v ...interface{}) {
+	l.logger.Warning(l.redactor.String(fmt.Sprint(v...)))
+}
+func (l *redactLogger) Error(v ...interface{}) { l.logger.Error(l.redactor.String(fmt.Sprint(v...))) }
+func (l *redactLogger) Critical(v ...interface{}) {
+	l.logger.Critical(l.redactor.String(fmt.Sprint(v...)))
+}
+func (l *redactLogger) Fatal(v ...interface{}) { l.logger.Fatal(l.redactor.String(fmt.Sprint(v...))) }
+
+// RedactSpanExporter redacts the attributes, events and status of the spans
+// before exporting them with exporter.
+func RedactSpanExporter(exporter sdktrace.SpanExporter, r *Redactor) sdktrace.SpanExporter {
+	return &redactExporter{SpanExporter: exporter, redactor: r}
+}
+
+type redactExporter struct {
+	sdktrace.SpanExporter
+	redactor *Redactor
+}
+
+func (e *redactExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		events := slices.Clone(span.Events())
+		for j := range events {
+			events[j].Attributes = e.redactor.attributes(events[j].Attributes)
+		}
+		status := span.Status()
+		status.Description = e.redactor.String(status.Description)
+		redacted[i] = redactedSpan{
+			ReadOnlySpan: span,
+			attributes:   e.redactor.attributes(span.Attributes()),
+			events:       events,
+			status:       status,
+		}
+	}
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+// redactedSpan overrides the attributes, events and status of a span with
+// their redacted copies.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+	status     sdktrace.Status
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue { return s.attributes }
+func (s redactedSpan) Events() []sdktrace.Event         { return s.events }
+func (s redactedSpan) Status() sdktrace.Status          { return s.status }
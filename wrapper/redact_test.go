@@ -0,0 +1,120 @@
+package wrapper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRedactor(t *testing.T) {
+	r := wrapper.NewRedactor(wrapper.RedactionConfig{
+		Fields:      map[string]wrapper.RedactAction{"user.email": wrapper.RedactHash, "org_id": wrapper.RedactDrop},
+		Headers:     map[string]wrapper.RedactAction{"x-api-key": wrapper.RedactMask},
+		ProtoFields: map[string]wrapper.RedactAction{"email": wrapper.RedactHash},
+		HashKey:     "secret",
+	})
+
+	t.Run("should redact json bodies", func(t *testing.T) {
+		body := r.JSON([]byte(`{"user":{"email":"a@b.co","password":"hunter2","org_id":"org1"},"email":"c@d.co","tokens":[{"access_token":"t1"}]}`))
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &got))
+		user := got["user"].(map[string]interface{})
+		assert.Regexp(t, `^sha256:[0-9a-f]{32}$`, user["email"])
+		assert.Equal(t, "[REDACTED]", user["password"])
+		assert.NotContains(t, user, "org_id")
+		assert.Equal(t, "c@d.co", got["email"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"access_token": "[REDACTED]"}}, got["tokens"])
+	})
+
+	t.Run("should hash equal values alike", func(t *testing.T) {
+		a := r.JSON([]byte(`{"user":{"email":"a@b.co"}}`))
+		b := r.JSON([]byte(`{"user":{"email":"a@b.co"}}`))
+		c := r.JSON([]byte(`{"user":{"email":"x@b.co"}}`))
+		assert.Equal(t, a, b)
+		assert.NotEqual(t, a, c)
+	})
+
+	t.Run("should redact form bodies and values", func(t *testing.T) {
+		assert.Equal(t, "email=c%40d.co&password=%5BREDACTED%5D", string(r.JSON([]byte("email=c%40d.co&password=hunter2&org_id=org1"))))
+		assert.Equal(t, url.Values{"refresh_token": {"[REDACTED]"}}, r.Form(url.Values{"refresh_token": {"t1"}, "org_id": {"org1"}}))
+	})
+
+	t.Run("should redact headers", func(t *testing.T) {
+		h := http.Header{"Authorization": {"Bearer t1"}, "X-Api-Key": {"k1"}, "Accept": {"application/json"}}
+		assert.Equal(t, http.Header{"Authorization": {"[REDACTED]"}, "X-Api-Key": {"[REDACTED]"}, "Accept": {"application/json"}}, r.Headers(h))
+		assert.Equal(t, "Bearer t1", h.Get("Authorization"))
+	})
+
+	t.Run("should redact proto messages", func(t *testing.T) {
+		msg := &client.UserRequest{Email: "a@b.co", Password: "hunter2", OrgId: "org1"}
+		redacted := r.Proto(msg).(*client.UserRequest)
+		assert.Equal(t, "[REDACTED]", redacted.Password)
+		assert.Regexp(t, `^sha256:[0-9a-f]{32}$`, redacted.Email)
+		assert.Equal(t, "org1", redacted.OrgId)
+		assert.Equal(t, "hunter2", msg.Password)
+	})
+
+	t.Run("should redact log messages", func(t *testing.T) {
+		assert.Equal(t,
+			`req path: /v1/users/token?access_token=[REDACTED]&org=1 Authorization: [REDACTED] body {"password":"[REDACTED]"}`,
+			r.String(`req path: /v1/users/token?access_token=t1&org=1 Authorization: Bearer t1 body {"password":"hunter2"}`))
+	})
+
+	t.Run("should redact span attributes", func(t *testing.T) {
+		kv, keep := r.Attribute(attribute.String("http.request.header.authorization", "Bearer t1"))
+		assert.True(t, keep)
+		assert.Equal(t, "[REDACTED]", kv.Value.AsString())
+		_, keep = r.Attribute(attribute.String("user.org_id", "org1"))
+		assert.False(t, keep)
+		kv, _ = r.Attribute(attribute.String("exception.message", "login failed password=hunter2"))
+		assert.Equal(t, "login failed password=[REDACTED]", kv.Value.AsString())
+	})
+}
+
+func TestRedactionOutputs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	r := wrapper.NewRedactor(wrapper.RedactionConfig{})
+
+	t.Run("should redact the logs", func(t *testing.T) {
+		mockedLogger := mocks.NewMockLogger(ctrl)
+		mockedLogger.EXPECT().Error("error while making grpc call: refresh_token=[REDACTED] rejected")
+
+		wrapper.RedactLogger(mockedLogger, r).Error("error while making grpc call: ", "refresh_token=r1 rejected")
+	})
+
+	t.Run("should redact the spans", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(wrapper.RedactSpanExporter(exporter, r)))
+
+		_, span := tp.Tracer("test").Start(context.Background(), "POST /v1/users/token")
+		span.SetAttributes(attribute.String("http.request.header.authorization", "Bearer t1"))
+		span.RecordError(errors.New("invalid access_token: t1"))
+		span.SetStatus(otelcodes.Error, "invalid access_token: t1")
+		span.End()
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Contains(t, spans[0].Attributes, attribute.String("http.request.header.authorization", "[REDACTED]"))
+		require.Len(t, spans[0].Events, 1)
+		assert.Contains(t, spans[0].Events[0].Attributes, attribute.String("exception.message", "invalid access_token: [REDACTED]"))
+		assert.Equal(t, "invalid access_token: [REDACTED]", spans[0].Status.Description)
+		assert.Equal(t, "POST /v1/users/token", spans[0].Name)
+	})
+}
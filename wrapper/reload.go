@@ -0,0 +1,179 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Builder turns a config into the handler serving it. release is called once
+// the handler is retired and its in-flight requests are drained, it should
+// close the connections the handler uses.
+type Builder func(cfg Config) (handler http.Handler, release func(), err error)
+
+// generation is one built config, serving requests until it is replaced.
+type generation struct {
+	cfg      Config
+	handler  http.Handler
+	release  func()
+	drain    time.Duration
+	inflight atomic.Int64
+}
+
+type reloader struct {
+	build   Builder
+	current atomic.Pointer[generation]
+	logger  Logger
+	// mu serializes the builds, so that a rebuild never swaps in a config
+	// older than the one reloaded meanwhile.
+	mu sync.Mutex
+}
+
+// NewReloader builds cfg and serves it until Reload swaps in a new one.
+func NewReloader(logger Logger, build Builder, cfg Config) (*reloader, error) {
+	r := &reloader{
+		build:  build,
+		logger: logger,
+	}
+	handler, release, err := build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(&generation{cfg: cfg, handler: handler, release: release, drain: time.Duration(cfg.DrainTimeout)})
+	return r, nil
+}
+
+func (r *reloader) ServeHTTP(respWtr http.ResponseWriter, req *http.Request) {
+	g := r.acquire()
+	defer g.inflight.Add(-1)
+	g.handler.ServeHTTP(respWtr, req)
+}
+
+// acquire returns the current generation with its in-flight count raised. The
+// pointer is checked again after counting, so a generation being drained never
+// picks up new requests.
+func (r *reloader) acquire() *generation {
+	for {
+		g := r.current.Load()
+		g.inflight.Add(1)
+		if r.current.Load() == g {
+			return g
+		}
+		g.inflight.Add(-1)
+	}
+}
+
+// Config returns the config being served.
+func (r *reloader) Config() Config {
+	return r.current.Load().cfg
+}
+
+// Reload builds cfg and swaps it in. When the build fails the current config
+// keeps serving and the error is returned.
+func (r *reloader) Reload(cfg Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.swap(cfg)
+}
+
+// Rebuild builds the current config again and swaps it in, such as when the
+// services discovered on the backend changed.
+func (r *reloader) Rebuild() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.swap(r.current.Load().cfg)
+}
+
+// RebuildOn rebuilds the current config whenever changed signals, until ctx
+// is done. Failed builds are logged, the current config keeps serving.
+func (r *reloader) RebuildOn(ctx context.Context, changed <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+		if err := r.Rebuild(); err != nil {
+			r.logger.Error("unable to rebuild the config, keeping current one: ", err)
+			continue
+		}
+		r.logger.Info("config rebuilt")
+	}
+}
+
+func (r *reloader) swap(cfg Config) error {
+	handler, release, err := r.build(cfg)
+	if err != nil {
+		return err
+	}
+	old := r.current.Swap(&generation{cfg: cfg, handler: handler, release: release, drain: time.Duration(cfg.DrainTimeout)})
+	go r.retire(old)
+	return nil
+}
+
+// retire waits for the in-flight requests of g, at most g.drain, then releases it.
+func (r *reloader) retire(g *generation) {
+	deadline := time.Now().Add(g.drain)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for g.inflight.Load() > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+	if n := g.inflight.Load(); n > 0 {
+		r.logger.Warning("drain timeout reached, closing previous config with in-flight requests: ", n)
+	}
+	if g.release != nil {
+		g.release()
+	}
+}
+
+// Watch polls cfg.ConfigFile every cfg.ReloadInterval and reloads the config
+// parsed from raw whenever the file content changes. Invalid configs are
+// logged and skipped. Watch returns when ctx is done, releasing the current
+// generation.
+func (r *reloader) Watch(ctx context.Context, raw map[string]interface{}, cfg Config) {
+	defer func() {
+		if g := r.current.Load(); g.release != nil {
+			g.release()
+		}
+	}()
+	if cfg.ConfigFile == "" {
+		<-ctx.Done()
+		return
+	}
+
+	last, _ := os.ReadFile(cfg.ConfigFile)
+	ticker := time.NewTicker(time.Duration(cfg.ReloadInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		content, err := os.ReadFile(cfg.ConfigFile)
+		if err != nil {
+			r.logger.Error("unable to read config file, keeping current config: ", err)
+			continue
+		}
+		if bytes.Equal(content, last) {
+			continue
+		}
+		last = content
+
+		next, err := ParseConfig(raw)
+		if err == nil {
+			err = r.Reload(next)
+		}
+		if err != nil {
+			r.logger.Error("invalid config, keeping current one: ", err)
+			continue
+		}
+		r.logger.Info("config reloaded from ", cfg.ConfigFile)
+	}
+}
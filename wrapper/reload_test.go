@@ -0,0 +1,132 @@
+package wrapper_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestReloader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+
+	var released, builds atomic.Int32
+	// requests to /slow signal slowStarted and wait for unblockSlow
+	slowStarted, unblockSlow := make(chan struct{}), make(chan struct{})
+	build := func(cfg wrapper.Config) (http.Handler, func(), error) {
+		if cfg.Host == "invalid" {
+			return nil, nil, errors.New("unable to create client")
+		}
+		builds.Add(1)
+		host := cfg.Host
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				slowStarted <- struct{}{}
+				<-unblockSlow
+			}
+			_, _ = w.Write([]byte(host))
+		}), func() { released.Add(1) }, nil
+	}
+
+	serve := func(h http.Handler, path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Body.String()
+	}
+
+	cfg := wrapper.DefaultConfig()
+	cfg.Host = "auth-a"
+	r, err := wrapper.NewReloader(mockedLogger, build, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "auth-a", serve(r, "/"))
+
+	t.Run("should drain in-flight requests before releasing", func(t *testing.T) {
+		done := make(chan string)
+		go func() { done <- serve(r, "/slow") }()
+		<-slowStarted
+
+		next := wrapper.DefaultConfig()
+		next.Host = "auth-b"
+		require.NoError(t, r.Reload(next))
+
+		assert.Equal(t, "auth-b", serve(r, "/"))
+		assert.Equal(t, int32(0), released.Load())
+		close(unblockSlow)
+		assert.Equal(t, "auth-a", <-done)
+		assert.Eventually(t, func() bool { return released.Load() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should keep the current config when the new one fails", func(t *testing.T) {
+		next := wrapper.DefaultConfig()
+		next.Host = "invalid"
+		assert.Error(t, r.Reload(next))
+		assert.Equal(t, "auth-b", serve(r, "/"))
+	})
+
+	t.Run("should reload when the config file changes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "grpc-proxy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"host": "auth-c"}`), 0o600))
+
+		raw := map[string]interface{}{"host": "auth-inline", "config_file": path, "reload_interval": "10ms"}
+		cfg, err := wrapper.ParseConfig(raw)
+		require.NoError(t, err)
+		require.NoError(t, r.Reload(cfg))
+		assert.Equal(t, "auth-c", serve(r, "/"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		watching := make(chan struct{})
+		go func() {
+			defer close(watching)
+			r.Watch(ctx, raw, cfg)
+		}()
+		// stop watching before the config file is removed
+		defer func() {
+			cancel()
+			<-watching
+		}()
+
+		var rejected atomic.Bool
+		mockedLogger.EXPECT().Error("invalid config, keeping current one: ", gomock.Any()).
+			MinTimes(1).
+			Do(func(...interface{}) { rejected.Store(true) })
+		// the watcher may read the file before or after the first write, so
+		// keep writing invalid configs until one is rejected
+		var n int
+		assert.Eventually(t, func() bool {
+			n++
+			return os.WriteFile(path, []byte(fmt.Sprintf(`{"host": %d}`, n)), 0o600) == nil && rejected.Load()
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, "auth-c", serve(r, "/"))
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"host": "auth-d"}`), 0o600))
+		assert.Eventually(t, func() bool { return serve(r, "/") == "auth-d" }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should rebuild the current config when signaled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changed := make(chan struct{})
+		go r.RebuildOn(ctx, changed)
+
+		before := builds.Load()
+		changed <- struct{}{}
+		assert.Eventually(t, func() bool { return builds.Load() == before+1 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, "auth-d", serve(r, "/"))
+	})
+}
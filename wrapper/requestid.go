@@ -0,0 +1,110 @@
+package wrapper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID correlating the gateway and backend logs of
+// a request. It is forwarded to the backend as x-request-id metadata.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDCtxKey struct{}
+
+// RequestIDFromContext returns the request ID set by RequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// RequestID keeps the X-Request-ID of the incoming request, or generates a
+// UUID when it is missing or malformed, so that handlers forward it to the
+// backend with the other headers. The ID is echoed on the response, added to
+// the logs of RequestLogger and to the body of error responses without one.
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newUUID()
+			req.Header.Set(RequestIDHeader, id)
+		}
+		ctx := context.WithValue(req.Context(), requestIDCtxKey{}, id)
+		ctx = context.WithValue(ctx, logFieldsCtxKey{}, &logFields{requestID: id, clientIP: clientIP(req)})
+		req = req.WithContext(ctx)
+
+		w := &requestIDWriter{ResponseWriter: respWtr, id: id}
+		next(w, req)
+		if w.errorBody {
+			body, _ := json.Marshal(errorBody{Error: http.StatusText(w.status), RequestID: id})
+			_, _ = respWtr.Write(body)
+		}
+	}
+}
+
+// errorBody is written for error responses the handlers left empty.
+type errorBody struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id"`
+}
+
+// requestIDWriter echoes the request ID and tells whether an error response
+// is left without a body.
+type requestIDWriter struct {
+	http.ResponseWriter
+	id        string
+	status    int
+	errorBody bool
+}
+
+func (w *requestIDWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	h := w.ResponseWriter.Header()
+	h.Set(RequestIDHeader, w.id)
+	if status >= 400 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/json")
+		w.errorBody = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.errorBody = false
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// validRequestID accepts IDs of visible ASCII characters up to 128 bytes,
+// long enough for UUIDs, ULIDs and most tracing IDs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,62 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRequestID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+
+	t.Run("should keep the incoming ID and log it", func(t *testing.T) {
+		var forwarded string
+		handler := wrapper.RequestID(func(w http.ResponseWriter, req *http.Request) {
+			forwarded = req.Header.Get("X-Request-ID")
+			wrapper.RequestLogger(req.Context(), mockedLogger).Info("call to GetAppGroup successful")
+			w.WriteHeader(http.StatusOK)
+		})
+
+		mockedLogger.EXPECT().Info("call to GetAppGroup successful request_id=01HZX3K2N4J5B6C7D8E9F0G1H2 client_ip=192.0.2.1")
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+		req.Header.Set("X-Request-ID", "01HZX3K2N4J5B6C7D8E9F0G1H2")
+		handler(w, req)
+
+		assert.Equal(t, "01HZX3K2N4J5B6C7D8E9F0G1H2", forwarded)
+		assert.Equal(t, "01HZX3K2N4J5B6C7D8E9F0G1H2", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("should generate an ID and add it to error bodies", func(t *testing.T) {
+		var fromCtx string
+		handler := wrapper.RequestID(func(w http.ResponseWriter, req *http.Request) {
+			fromCtx = wrapper.RequestIDFromContext(req.Context())
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+		req.Header.Set("X-Request-ID", "not a valid id")
+		handler(w, req)
+
+		id := w.Header().Get("X-Request-ID")
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+		assert.Equal(t, id, fromCtx)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"error":"Service Unavailable","request_id":"`+id+`"}`, w.Body.String())
+	})
+
+	t.Run("should leave the logger untouched without an ID", func(t *testing.T) {
+		assert.Equal(t, wrapper.Logger(mockedLogger), wrapper.RequestLogger(context.Background(), mockedLogger))
+	})
+}
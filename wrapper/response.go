@@ -0,0 +1,138 @@
+package wrapper
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseCapture passes a response through to the client while recording
+// its status, header and body for middlewares that need them afterwards.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+	// onHeader, when set, may amend the header right before it is sent.
+	onHeader func(status int, header http.Header)
+}
+
+func newResponseCapture(w http.ResponseWriter) *responseCapture {
+	return &responseCapture{ResponseWriter: w}
+}
+
+// WriteHeader records the first status only, as the client only ever sees that one.
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if c.onHeader != nil {
+		c.onHeader(status, c.ResponseWriter.Header())
+	}
+	c.header = c.ResponseWriter.Header().Clone()
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Status returns the status sent to the client, 200 when the handler wrote nothing.
+func (c *responseCapture) Status() int {
+	if c.status == 0 {
+		return http.StatusOK
+	}
+	return c.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// responseBuffer holds a whole response back so that a middleware can decide
+// to send it or another one once the handler returned.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Status returns the status written by the handler, 200 when it wrote nothing.
+func (b *responseBuffer) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// flush sends the buffered response to w.
+func (b *responseBuffer) flush(w http.ResponseWriter) {
+	for k, vs := range b.header {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(b.Status())
+	_, _ = w.Write(b.body.Bytes())
+}
+
+// statusWriter records the status and the body size of a response passing
+// through, without keeping the body.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Status returns the status sent to the client, 200 when the handler wrote nothing.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,113 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// The phases of a request timed by the handlers, in order.
+const (
+	phaseDecode   = "decode"
+	phaseMetadata = "metadata"
+	phaseGRPC     = "grpc"
+	phaseMarshal  = "marshal"
+	phaseWrite    = "write"
+)
+
+var phases = []string{phaseDecode, phaseMetadata, phaseGRPC, phaseMarshal, phaseWrite}
+
+type slowCtxKey struct{}
+
+// phaseTimer splits the duration of a request into phases, each one lasting
+// from the previous mark to its own.
+type phaseTimer struct {
+	mu        sync.Mutex
+	last      time.Time
+	durations map[string]time.Duration
+	connState string
+	peer      string
+}
+
+// markPhase ends phase for the request of ctx, if it is timed.
+func markPhase(ctx context.Context, phase string) {
+	t, _ := ctx.Value(slowCtxKey{}).(*phaseTimer)
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	t.durations[phase] += now.Sub(t.last)
+	t.last = now
+	t.mu.Unlock()
+}
+
+// SlowRequests logs a warning for the requests taking longer than threshold,
+// with the time spent in each phase and the backend connection state and peer
+// at call time. The phases not accounted for by the handler, such as the
+// time spent in the middlewares, are reported as other. The backend details
+// need SlowUnaryClientInterceptor on the connections.
+func SlowRequests(logger Logger, threshold time.Duration) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			t := &phaseTimer{last: start, durations: make(map[string]time.Duration, len(phases))}
+			next(respWtr, req.WithContext(context.WithValue(req.Context(), slowCtxKey{}, t)))
+
+			total := time.Since(start)
+			if total <= threshold {
+				return
+			}
+
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			var b strings.Builder
+			accounted := time.Duration(0)
+			for _, phase := range phases {
+				fmt.Fprintf(&b, " %s=%s", phase, t.durations[phase].Round(time.Microsecond))
+				accounted += t.durations[phase]
+			}
+			fmt.Fprintf(&b, " other=%s", (total - accounted).Round(time.Microsecond))
+			fmt.Fprintf(&b, " conn_state=%s peer=%s", orDash(t.connState), orDash(t.peer))
+			// the backend is the bottleneck when the call takes most of the request
+			bottleneck := "gateway"
+			if t.durations[phaseGRPC] > total/2 {
+				bottleneck = "backend"
+			}
+			fmt.Fprintf(&b, " bottleneck=%s", bottleneck)
+
+			RequestLogger(req.Context(), logger).Warning("slow request: took ", total.Round(time.Microsecond), " over ", threshold, b.String())
+		}
+	}
+}
+
+// SlowUnaryClientInterceptor records the connectivity state of the
+// connection and the address of the backend serving the calls of the
+// requests timed by SlowRequests.
+func SlowUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	t, _ := ctx.Value(slowCtxKey{}).(*phaseTimer)
+	if t == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	var state string
+	if cc != nil {
+		state = cc.GetState().String()
+	}
+	var p peer.Peer
+	err := invoker(ctx, method, req, reply, cc, append(slices.Clip(opts), grpc.Peer(&p))...)
+
+	t.mu.Lock()
+	t.connState = state
+	if p.Addr != nil {
+		t.peer = p.Addr.String()
+	}
+	t.mu.Unlock()
+	return err
+}
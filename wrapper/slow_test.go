@@ -0,0 +1,76 @@
+package wrapper_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/client"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+)
+
+func TestSlowRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := mocks.NewMockAuthServiceClient(ctrl)
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Info(gomock.Any()).AnyTimes()
+
+	// a connection that is never used, for its connectivity state
+	cc, err := grpc.NewClient("passthrough:///auth:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	// getAppGroup runs the interceptor around a backend call taking delay
+	getAppGroup := func(delay time.Duration) func(context.Context, *client.GetAppGroupRequest, ...grpc.CallOption) (*client.AppGroupResponse, error) {
+		return func(ctx context.Context, in *client.GetAppGroupRequest, opts ...grpc.CallOption) (*client.AppGroupResponse, error) {
+			invoker := func(_ context.Context, _ string, _, _ any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+				time.Sleep(delay)
+				for _, o := range opts {
+					if p, ok := o.(grpc.PeerCallOption); ok {
+						*p.PeerAddr = peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 50051}}
+					}
+				}
+				return nil
+			}
+			err := wrapper.SlowUnaryClientInterceptor(ctx, "/grpc.AuthService/GetAppGroup", in, nil, cc, invoker, opts...)
+			return &client.AppGroupResponse{Id: in.Id}, err
+		}
+	}
+
+	handler := wrapper.RequestID(wrapper.LogRoute("/v1/app-groups/{id}", "GetAppGroup")(
+		wrapper.SlowRequests(mockedLogger, 20*time.Millisecond)(wrapper.NewWrapperClient(mockedClient, mockedLogger).HandleGetAppGroup)))
+
+	serve := func() {
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+		req.SetPathValue("id", "appgrp123")
+		req.Header.Set("X-Request-ID", "req-1")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	t.Run("should log the phases of a slow request", func(t *testing.T) {
+		mockedClient.EXPECT().GetAppGroup(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(getAppGroup(40 * time.Millisecond))
+
+		var line string
+		mockedLogger.EXPECT().Warning(gomock.Any()).Do(func(v ...interface{}) { line = v[0].(string) })
+		serve()
+
+		assert.Regexp(t, `^slow request: took [0-9.]+ms over 20ms decode=\S+ metadata=\S+ grpc=[0-9.]+ms marshal=\S+ write=\S+ other=\S+ conn_state=IDLE peer=10\.0\.0\.7:50051 bottleneck=backend request_id=req-1 client_ip=192\.0\.2\.1 route=/v1/app-groups/\{id\} rpc=GetAppGroup`, line)
+	})
+
+	t.Run("should not log fast requests", func(t *testing.T) {
+		mockedClient.EXPECT().GetAppGroup(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(getAppGroup(0))
+		serve()
+	})
+}
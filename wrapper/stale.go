@@ -0,0 +1,155 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StaleConfig opts a GET route into serving its last successful response
+// when the backend is unavailable.
+type StaleConfig struct {
+	// Window is how long a successful response is kept as a fallback.
+	Window Duration `json:"window"`
+	// MaxEntries bounds the kept responses, the least recently used are evicted first.
+	MaxEntries int `json:"max_entries"`
+	// Headers are the request headers added to the key. As for the response
+	// cache, Authorization always is.
+	Headers []string `json:"headers"`
+}
+
+func (c *StaleConfig) setDefaults() {
+	*c = StaleConfig{
+		Window:     Duration(10 * time.Minute),
+		MaxEntries: 1000,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c StaleConfig) Validate(key string) error {
+	if c.Window <= 0 {
+		return &ConfigError{Key: joinKey(key, "window"), Err: errors.New("must be positive")}
+	}
+	if c.MaxEntries < 1 {
+		return &ConfigError{Key: joinKey(key, "max_entries"), Err: errors.New("must be at least 1")}
+	}
+	return nil
+}
+
+// StaleStats counts the stale responses served by a route.
+type StaleStats struct {
+	Served  uint64 `json:"served"`
+	Entries int    `json:"entries"`
+}
+
+type staleCtxKey struct{}
+
+// staleCall records the code of the last backend call made for a request.
+type staleCall struct {
+	code atomic.Uint32
+}
+
+type staleCache struct {
+	cfg     StaleConfig
+	store   CacheStore
+	headers []string
+	served  atomic.Uint64
+	logger  Logger
+}
+
+// NewStaleCache keeps the successful responses of a GET route in store and
+// serves them when the backend call fails with UNAVAILABLE or
+// DEADLINE_EXCEEDED. StaleUnaryClientInterceptor must be used when dialing
+// the backend for the failures to be seen.
+func NewStaleCache(logger Logger, cfg StaleConfig, store CacheStore) *staleCache {
+	return &staleCache{
+		cfg:     cfg,
+		store:   store,
+		headers: keyHeaders(cfg.Headers),
+		logger:  logger,
+	}
+}
+
+// Stale returns the LRU store of the stale responses of endpoint.
+func (s *RouteStores) Stale(endpoint string, maxEntries int) CacheStore {
+	return s.get("stale "+endpoint, maxEntries, func() any { return NewLRUStore(maxEntries) }).(CacheStore)
+}
+
+// Middleware holds back the response of next until it is known to be
+// neither a backend outage nor replaceable by a stale copy.
+func (s *staleCache) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		call := &staleCall{}
+		buf := newResponseBuffer()
+		next(buf, req.WithContext(context.WithValue(req.Context(), staleCtxKey{}, call)))
+
+		key := requestKey(req, s.headers)
+		switch code := codes.Code(call.code.Load()); {
+		case buf.Status() == http.StatusOK:
+			now := time.Now()
+			s.store.Set(key, CachedResponse{
+				Status:   buf.Status(),
+				Header:   buf.Header().Clone(),
+				Body:     buf.body.Bytes(),
+				StoredAt: now,
+				Expires:  now.Add(time.Duration(s.cfg.Window)),
+				Tag:      cacheTag(req),
+			})
+		case code == codes.Unavailable || code == codes.DeadlineExceeded:
+			if cached, ok := s.store.Get(key); ok {
+				s.served.Add(1)
+				RequestLogger(req.Context(), s.logger).Warning("serving stale response of ", req.URL.Path, " after backend error: ", code)
+				writeStale(respWtr, cached)
+				return
+			}
+		}
+		buf.flush(respWtr)
+	}
+}
+
+// StaleUnaryClientInterceptor records the outcome of the backend calls made
+// for the requests of stale-if-error routes.
+func StaleUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if call, ok := ctx.Value(staleCtxKey{}).(*staleCall); ok {
+		call.code.Store(uint32(status.Code(err)))
+	}
+	return err
+}
+
+// markUnavailable records an UNAVAILABLE outcome for a request rejected
+// before any backend call, so that stale-if-error routes still fall back.
+func markUnavailable(ctx context.Context) {
+	if call, ok := ctx.Value(staleCtxKey{}).(*staleCall); ok {
+		call.code.Store(uint32(codes.Unavailable))
+	}
+}
+
+// Stats returns how many stale responses were served and how many are kept.
+func (s *staleCache) Stats() StaleStats {
+	return StaleStats{
+		Served:  s.served.Load(),
+		Entries: s.store.Len(),
+	}
+}
+
+// writeStale answers with a kept response, flagged so that clients neither
+// mistake it for a fresh one nor cache it.
+func writeStale(respWtr http.ResponseWriter, cached CachedResponse) {
+	for k, vs := range cached.Header {
+		respWtr.Header()[k] = append([]string(nil), vs...)
+	}
+	respWtr.Header().Set("Age", fmt.Sprint(int(time.Since(cached.StoredAt).Seconds())))
+	respWtr.Header().Set("Cache-Control", "no-store")
+	respWtr.Header().Set("Warning", `110 - "Response is Stale"`)
+	respWtr.Header().Set("X-Cache", "STALE")
+	respWtr.WriteHeader(cached.Status)
+	_, _ = respWtr.Write(cached.Body)
+}
@@ -0,0 +1,108 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStaleCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedLogger := mocks.NewMockLogger(ctrl)
+	mockedLogger.EXPECT().Warning(gomock.Any()).AnyTimes()
+
+	// backendErr is what the next backend call fails with, nil for a success
+	var backendErr error
+	backend := func(w http.ResponseWriter, req *http.Request) {
+		invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+			return backendErr
+		}
+		err := wrapper.StaleUnaryClientInterceptor(req.Context(), "/grpc.AuthService/GetAppGroup", nil, nil, nil, invoker)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"appgrp123"}`))
+	}
+
+	get := func(h http.HandlerFunc, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	newStale := func(window time.Duration) http.HandlerFunc {
+		cfg := wrapper.StaleConfig{Window: wrapper.Duration(window), MaxEntries: 10}
+		return wrapper.NewStaleCache(mockedLogger, cfg, wrapper.NewLRUStore(cfg.MaxEntries)).Middleware(backend)
+	}
+
+	t.Run("should serve the last response when the backend is unavailable", func(t *testing.T) {
+		h := newStale(time.Minute)
+
+		backendErr = nil
+		fresh := get(h, "/v1/app-groups/appgrp123")
+		assert.Equal(t, http.StatusOK, fresh.Code)
+		assert.Empty(t, fresh.Header().Get("X-Cache"))
+
+		for _, code := range []codes.Code{codes.Unavailable, codes.DeadlineExceeded} {
+			backendErr = status.Error(code, "backend down")
+			w := get(h, "/v1/app-groups/appgrp123")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+			assert.Equal(t, `110 - "Response is Stale"`, w.Header().Get("Warning"))
+			assert.JSONEq(t, `{"id":"appgrp123"}`, w.Body.String())
+		}
+	})
+
+	t.Run("should not serve the response of another caller", func(t *testing.T) {
+		h := newStale(time.Minute)
+		getAs := func(token string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			h(w, req)
+			return w
+		}
+
+		backendErr = nil
+		getAs("token-a")
+		backendErr = status.Error(codes.Unavailable, "backend down")
+		assert.Equal(t, http.StatusInternalServerError, getAs("token-b").Code)
+		assert.Equal(t, "STALE", getAs("token-a").Header().Get("X-Cache"))
+	})
+
+	t.Run("should pass other errors through", func(t *testing.T) {
+		h := newStale(time.Minute)
+
+		backendErr = nil
+		get(h, "/v1/app-groups/appgrp123")
+		backendErr = status.Error(codes.NotFound, "no such app group")
+		assert.Equal(t, http.StatusInternalServerError, get(h, "/v1/app-groups/appgrp123").Code)
+	})
+
+	t.Run("should fail once the window expired or without a previous response", func(t *testing.T) {
+		h := newStale(50 * time.Millisecond)
+
+		backendErr = status.Error(codes.Unavailable, "backend down")
+		assert.Equal(t, http.StatusInternalServerError, get(h, "/v1/app-groups/appgrp123").Code)
+
+		backendErr = nil
+		get(h, "/v1/app-groups/appgrp123")
+		time.Sleep(60 * time.Millisecond)
+		backendErr = status.Error(codes.Unavailable, "backend down")
+		assert.Equal(t, http.StatusInternalServerError, get(h, "/v1/app-groups/appgrp123").Code)
+	})
+}
@@ -0,0 +1,28 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const StatsEndpoint = "/__stats"
+
+// StatsHandler serves a JSON snapshot of the plugin runtime state, each key
+// being filled by its func at request time.
+type StatsHandler map[string]func() interface{}
+
+// Params returns the wrapper param registering the stats route.
+func (s StatsHandler) Params() []WrapperParam {
+	return []WrapperParam{{Endpoint: StatsEndpoint, Method: "GET", Handler: s.HandleStats}}
+}
+
+func (s StatsHandler) HandleStats(respWtr http.ResponseWriter, req *http.Request) {
+	snapshot := make(map[string]interface{}, len(s))
+	for k, f := range s {
+		snapshot[k] = f()
+	}
+	respWtr.Header().Set("Content-Type", "application/json")
+	respWtr.Header().Set("Cache-Control", "no-store")
+	respWtr.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(respWtr).Encode(snapshot)
+}
@@ -0,0 +1,210 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TracingConfig exports the spans of the wrapper requests and backend calls.
+type TracingConfig struct {
+	// Exporter is "otlp" to send spans to an OTLP/gRPC collector, "stdout"
+	// to print them or "memory" to keep them for MemorySpans.
+	Exporter string `json:"exporter"`
+	// Endpoint is the host:port of the OTLP collector.
+	Endpoint string `json:"endpoint"`
+	// Insecure disables TLS towards the collector.
+	Insecure    bool   `json:"insecure"`
+	ServiceName string `json:"service_name"`
+	// SampleRatio is the share of the traces started by the gateway that are
+	// recorded, traces started upstream follow the sampling of their parent.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+func (c *TracingConfig) setDefaults() {
+	*c = TracingConfig{
+		Exporter:    "otlp",
+		Endpoint:    "localhost:4317",
+		ServiceName: "krakend-grpc-proxy",
+		SampleRatio: 1,
+	}
+}
+
+// Validate reports the first invalid key, prefixed with key.
+func (c TracingConfig) Validate(key string) error {
+	switch c.Exporter {
+	case "otlp":
+		if c.Endpoint == "" {
+			return &ConfigError{Key: joinKey(key, "endpoint"), Err: errors.New("is required")}
+		}
+	case "stdout", "memory":
+	default:
+		return &ConfigError{Key: joinKey(key, "exporter"), Err: fmt.Errorf("unsupported exporter %q, must be one of otlp, stdout or memory", c.Exporter)}
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return &ConfigError{Key: joinKey(key, "sample_ratio"), Err: errors.New("must be between 0 and 1")}
+	}
+	return nil
+}
+
+// memoryExporter keeps the spans of every provider using the memory
+// exporter, across reloads.
+var memoryExporter = tracetest.NewInMemoryExporter()
+
+// MemorySpans returns the spans kept by the memory exporter, redacted.
+func MemorySpans() tracetest.SpanStubs {
+	return memoryExporter.GetSpans()
+}
+
+// keptSpansExporter does not reset the spans of the memory exporter when a
+// provider shuts down.
+type keptSpansExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keptSpansExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// NewTracerProvider creates the provider exporting spans as configured by
+// cfg, redacted by redactor. Shutdown flushes the pending spans.
+func NewTracerProvider(ctx context.Context, cfg TracingConfig, redactor *Redactor) (*sdktrace.TracerProvider, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch cfg.Exporter {
+	case "memory":
+		exporter = keptSpansExporter{memoryExporter}
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s exporter: %w", cfg.Exporter, err)
+	}
+	processor := sdktrace.WithBatcher(RedactSpanExporter(exporter, redactor))
+	if cfg.Exporter == "memory" {
+		// exported as soon as they end, so that tests see them
+		processor = sdktrace.WithSyncer(RedactSpanExporter(exporter, redactor))
+	}
+	return sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	), nil
+}
+
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TraceContext
+}
+
+// NewTracing starts spans with tp. Use its Middleware on the routes and its
+// UnaryClientInterceptor, first in the chain, when dialing the backend.
+func NewTracing(tp trace.TracerProvider) *tracing {
+	return &tracing{tracer: tp.Tracer("github.com/zero-shubham/surveyx-apigw/wrapper")}
+}
+
+// Middleware wraps the requests of the route endpoint, served by rpc, in a
+// server span continuing the trace of the incoming traceparent header.
+func (t *tracing) Middleware(endpoint, rpc string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(respWtr http.ResponseWriter, req *http.Request) {
+			ctx := t.propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := t.tracer.Start(ctx, req.Method+" "+endpoint,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRoute(endpoint),
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.RPCMethod(rpc),
+				),
+			)
+			defer span.End()
+			if id := RequestIDFromContext(ctx); id != "" {
+				span.SetAttributes(attribute.String("http.request.header.x-request-id", id))
+			}
+
+			w := &statusWriter{ResponseWriter: respWtr}
+			next(w, req.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(w.Status()))
+			if w.Status() >= 500 {
+				span.SetStatus(otelcodes.Error, http.StatusText(w.Status()))
+			}
+		}
+	}
+}
+
+// UnaryClientInterceptor wraps each backend call in a client span and sends
+// its context in the traceparent and tracestate metadata, replacing the
+// ones forwarded from the incoming request.
+func (t *tracing) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	service, rpc, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	ctx, span := t.tracer.Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.RPCService(service),
+			semconv.RPCMethod(rpc),
+		),
+	)
+	defer span.End()
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Delete("traceparent")
+	md.Delete("tracestate")
+	t.propagator.Inject(ctx, metadataCarrier(md))
+
+	err := invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	st := status.Convert(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+	if err != nil {
+		span.SetStatus(otelcodes.Error, st.Message())
+	}
+	return err
+}
+
+// metadataCarrier lets a propagator write grpc metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if vs := metadata.MD(c).Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,90 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing := wrapper.NewTracing(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return status.Error(codes.Unavailable, "backend down")
+	}
+	// handler forwards the request headers like the wrapper handlers do
+	handler := tracing.Middleware("/v1/app-groups/{id}", "GetAppGroup")(func(w http.ResponseWriter, req *http.Request) {
+		ctx := metadata.AppendToOutgoingContext(req.Context(), "traceparent", req.Header.Get("traceparent"))
+		err := tracing.UnaryClientInterceptor(ctx, "/grpc.AuthService/GetAppGroup", nil, nil, nil, invoker)
+		assert.Error(t, err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/appgrp123", nil)
+	req.Header.Set("traceparent", incoming)
+	handler(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	client, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /v1/app-groups/{id}", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.String("http.route", "/v1/app-groups/{id}"))
+	assert.Contains(t, server.Attributes, attribute.String("rpc.method", "GetAppGroup"))
+	assert.Contains(t, server.Attributes, attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+	assert.Equal(t, otelcodes.Error, server.Status.Code)
+
+	assert.Equal(t, "grpc.AuthService/GetAppGroup", client.Name)
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind)
+	assert.Equal(t, server.SpanContext.SpanID(), client.Parent.SpanID())
+	assert.Contains(t, client.Attributes, attribute.String("rpc.service", "grpc.AuthService"))
+	assert.Contains(t, client.Attributes, attribute.Int("rpc.grpc.status_code", int(codes.Unavailable)))
+
+	// the forwarded traceparent is replaced by the client span context
+	assert.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-" + client.SpanContext.SpanID().String() + "-01"}, outgoing.Get("traceparent"))
+}
+
+func TestTracerProvider(t *testing.T) {
+	t.Run("should keep the spans of the memory exporter", func(t *testing.T) {
+		tp, err := wrapper.NewTracerProvider(context.Background(), wrapper.TracingConfig{Exporter: "memory", ServiceName: "test", SampleRatio: 1}, wrapper.NewRedactor(wrapper.RedactionConfig{}))
+		require.NoError(t, err)
+		_, span := tp.Tracer("test").Start(context.Background(), "memory span")
+		span.End()
+		require.NoError(t, tp.Shutdown(context.Background()))
+
+		var names []string
+		for _, s := range wrapper.MemorySpans() {
+			names = append(names, s.Name)
+		}
+		assert.Contains(t, names, "memory span")
+	})
+
+	t.Run("should reject an unknown exporter", func(t *testing.T) {
+		err := wrapper.TracingConfig{Exporter: "jaeger", SampleRatio: 1}.Validate("tracing")
+		var cfgErr *wrapper.ConfigError
+		require.ErrorAs(t, err, &cfgErr)
+		assert.Equal(t, "tracing.exporter", cfgErr.Key)
+	})
+}
@@ -0,0 +1,270 @@
+package wrapper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// transcoder serves routes bound to RPCs by an HTTPRule, converting JSON
+// requests to messages and messages back to JSON without a generated handler.
+type transcoder struct {
+	conn    grpc.ClientConnInterface
+	logger  Logger
+	maxBody int64
+}
+
+// NewTranscoder invokes the RPCs through conn. Request bodies over maxBody
+// bytes answer 413, 0 leaves them unbounded.
+func NewTranscoder(logger Logger, conn grpc.ClientConnInterface, maxBody int) *transcoder {
+	return &transcoder{conn: conn, logger: logger, maxBody: int64(maxBody)}
+}
+
+// newMessage creates an md message, of its generated type when the plugin
+// was built with it and dynamic otherwise.
+func newMessage(md protoreflect.MessageDescriptor) protoreflect.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil && mt.Descriptor() == md {
+		return mt.New()
+	}
+	return dynamicpb.NewMessage(md)
+}
+
+// Handler serves the RPC of rule. The response fields are named as in the
+// proto files, like the generated handlers do.
+func (t *transcoder) Handler(rule *HTTPRule) http.HandlerFunc {
+	fullMethod := rule.FullMethod()
+	return func(respWtr http.ResponseWriter, req *http.Request) {
+		logger := RequestLogger(req.Context(), t.logger)
+		ctx := req.Context()
+
+		if t.maxBody > 0 {
+			req.Body = http.MaxBytesReader(respWtr, req.Body, t.maxBody)
+		}
+		in := newMessage(rule.Method.Input())
+		if err := decodeRequest(rule, req, in); err != nil {
+			logger.Error("error while decoding request: ", err)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respWtr.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			respWtr.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		markPhase(ctx, phaseDecode)
+
+		// Forward all headers to gRPC context
+		for k, vals := range req.Header {
+			for _, v := range vals {
+				ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+			}
+		}
+		markPhase(ctx, phaseMetadata)
+
+		out := newMessage(rule.Method.Output())
+		var respHeader metadata.MD
+		err := t.conn.Invoke(ctx, fullMethod, in.Interface(), out.Interface(), grpc.Header(&respHeader))
+		markPhase(ctx, phaseGRPC)
+		if err != nil {
+			logger.Error("error while making grpc call: ", err)
+			respWtr.WriteHeader(httpStatusFromError(err))
+			return
+		}
+
+		logger.Info("call to ", rule.Method.Name(), " successful")
+
+		respBody, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(out.Interface())
+		if err == nil && rule.ResponseBody != "" {
+			respBody, err = jsonField(respBody, rule.ResponseBody)
+		}
+		markPhase(ctx, phaseMarshal)
+		if err != nil {
+			logger.Error("error while marshaling resp: ", err)
+			respWtr.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Copy headers from the backend to the response writer
+		for k, hs := range respHeader {
+			for _, h := range hs {
+				respWtr.Header().Add(k, h)
+			}
+		}
+		respWtr.Header().Add("Content-Type", "application/json")
+		respWtr.WriteHeader(http.StatusOK)
+
+		_, err = respWtr.Write(respBody)
+		markPhase(ctx, phaseWrite)
+		if err != nil {
+			logger.Error("error while writing resp: ", err)
+		}
+	}
+}
+
+// jsonField returns the field name of the JSON object b, null when unset.
+func jsonField(b []byte, name string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	if field, ok := fields[name]; ok {
+		return field, nil
+	}
+	return []byte("null"), nil
+}
+
+// decodeRequest fills in from the body, path params and query params of req
+// as bound by rule.
+func decodeRequest(rule *HTTPRule, req *http.Request, in protoreflect.Message) error {
+	if rule.Body != "" {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		if len(body) > 0 {
+			if err := decodeBody(in, rule.Body, body); err != nil {
+				return err
+			}
+		}
+	}
+
+	bound := make(map[string]bool, len(rule.PathParams))
+	for _, param := range rule.PathParams {
+		if err := setField(in, param, req.PathValue(param)); err != nil {
+			return err
+		}
+		bound[param] = true
+	}
+	if rule.Body == "*" {
+		return nil
+	}
+	for key, values := range req.URL.Query() {
+		if bound[key] || (rule.Body != "" && (key == rule.Body || strings.HasPrefix(key, rule.Body+"."))) {
+			continue
+		}
+		if _, err := fieldByPath(in.Descriptor(), key); err != nil {
+			// unknown query params, such as cache busters, are ignored
+			continue
+		}
+		for _, v := range values {
+			if err := setField(in, key, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeBody fills the field name of in, or in itself when name is "*",
+// from the JSON body.
+func decodeBody(in protoreflect.Message, name string, body []byte) error {
+	if name == "*" {
+		return protojson.Unmarshal(body, in.Interface())
+	}
+	fd := in.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd != nil && fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+		return protojson.Unmarshal(body, in.Mutable(fd).Message().Interface())
+	}
+	return decodeFieldJSON(in, name, body)
+}
+
+// decodeFieldJSON fills the scalar, list or map field name of in from body,
+// by decoding {"name": body}. The other fields of in are left as they are.
+func decodeFieldJSON(in protoreflect.Message, name string, body []byte) error {
+	wrapped := make([]byte, 0, len(name)+len(body)+5)
+	wrapped = append(wrapped, `{"`...)
+	wrapped = append(wrapped, name...)
+	wrapped = append(wrapped, `":`...)
+	wrapped = append(wrapped, body...)
+	wrapped = append(wrapped, '}')
+	decoded := in.New()
+	if err := protojson.Unmarshal(wrapped, decoded.Interface()); err != nil {
+		return err
+	}
+	decoded.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		in.Set(fd, v)
+		return true
+	})
+	return nil
+}
+
+// setField sets the field of msg at a dotted path from its text value,
+// appending to list fields.
+func setField(msg protoreflect.Message, path string, value string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s has no message field %q", msg.Descriptor().FullName(), name)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1]))
+	if fd == nil || fd.IsMap() || fd.Kind() == protoreflect.MessageKind {
+		return fmt.Errorf("%s has no scalar field %q", msg.Descriptor().FullName(), names[len(names)-1])
+	}
+	v, err := parseScalar(fd, value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", path, err)
+	}
+	if fd.IsList() {
+		msg.Mutable(fd).List().Append(v)
+		return nil
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.BytesKind:
+		b, err := base64.URLEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.StdEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+	}
+}
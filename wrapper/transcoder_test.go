@@ -0,0 +1,149 @@
+package wrapper_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zero-shubham/surveyx-apigw/mocks"
+	"github.com/zero-shubham/surveyx-apigw/wrapper"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeConn answers every call with reply, recording the last call.
+type fakeConn struct {
+	reply  string
+	err    error
+	method string
+	in     string
+	md     metadata.MD
+}
+
+func (c *fakeConn) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	c.method = method
+	c.md, _ = metadata.FromOutgoingContext(ctx)
+	b, _ := protojson.MarshalOptions{UseProtoNames: true}.Marshal(args.(proto.Message))
+	c.in = string(b)
+	if c.err != nil {
+		return c.err
+	}
+	return protojson.Unmarshal([]byte(c.reply), reply.(proto.Message))
+}
+
+func (c *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streams are not supported")
+}
+
+func TestTranscoder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	logger := mocks.NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any()).AnyTimes()
+	logger.EXPECT().Error(gomock.Any()).AnyTimes()
+	routes, err := wrapper.AnnotatedRoutes(annotatedFile(t, groupRules).Services().ByName("Groups"))
+	require.NoError(t, err)
+	rule := func(method, endpoint string) *wrapper.HTTPRule {
+		for _, r := range routes {
+			if r.Method == method && r.Endpoint == endpoint {
+				return r.HTTPRule
+			}
+		}
+		t.Fatalf("no route %s %s", method, endpoint)
+		return nil
+	}
+	serve := func(conn *fakeConn, rule *wrapper.HTTPRule, req *http.Request, pathValues ...string) *httptest.ResponseRecorder {
+		for i := 0; i < len(pathValues); i += 2 {
+			req.SetPathValue(pathValues[i], pathValues[i+1])
+		}
+		w := httptest.NewRecorder()
+		wrapper.NewTranscoder(logger, conn, 64).Handler(rule)(w, req)
+		return w
+	}
+
+	t.Run("should bind path and query params", func(t *testing.T) {
+		conn := &fakeConn{reply: `{"group":{"id":"g1","name":"admins"},"etag":"v1"}`}
+		req := httptest.NewRequest(http.MethodGet, "/v1/groups/g1?verbose=true&fields=name&fields=id&cb=123", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		w := serve(conn, rule("GET", "/v1/groups/{id}"), req, "id", "g1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/groups.Groups/GetGroup", conn.method)
+		assert.JSONEq(t, `{"id":"g1","verbose":true,"fields":["name","id"]}`, conn.in)
+		assert.Equal(t, []string{"Bearer token"}, conn.md.Get("authorization"))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		// response_body answers the group only
+		assert.JSONEq(t, `{"id":"g1","name":"admins"}`, w.Body.String())
+	})
+
+	t.Run("should bind the whole body", func(t *testing.T) {
+		conn := &fakeConn{reply: `{"group":{"id":"g2"}}`}
+		req := httptest.NewRequest(http.MethodPost, "/v1/groups?size=3", strings.NewReader(`{"name":"ops","scopes":["read"]}`))
+		w := serve(conn, rule("POST", "/v1/groups"), req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		// query params are ignored when the body is the whole message
+		assert.JSONEq(t, `{"name":"ops","scopes":["read"]}`, conn.in)
+		assert.JSONEq(t, `{"group":{"id":"g2"}}`, w.Body.String())
+	})
+
+	t.Run("should bind a body field", func(t *testing.T) {
+		conn := &fakeConn{reply: `{}`}
+		req := httptest.NewRequest(http.MethodPatch, "/v1/groups/g3?dry_run=true", strings.NewReader(`{"name":"ops"}`))
+		w := serve(conn, rule("PATCH", "/v1/groups/{group.id}"), req, "group.id", "g3")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"group":{"id":"g3","name":"ops"},"dry_run":true}`, conn.in)
+	})
+
+	t.Run("should bind a list body field next to path and query params", func(t *testing.T) {
+		fieldRoutes, err := wrapper.AnnotatedRoutes(annotatedFile(t, map[string]*annotations.HttpRule{
+			"GetGroup": {Pattern: &annotations.HttpRule_Put{Put: "/v1/groups/{id}/fields"}, Body: "fields"},
+		}).Services().ByName("Groups"))
+		require.NoError(t, err)
+		require.Len(t, fieldRoutes, 1)
+
+		conn := &fakeConn{reply: `{}`}
+		req := httptest.NewRequest(http.MethodPut, "/v1/groups/g4/fields?verbose=true", strings.NewReader(`["name","id"]`))
+		w := serve(conn, fieldRoutes[0].HTTPRule, req, "id", "g4")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id":"g4","fields":["name","id"],"verbose":true}`, conn.in)
+	})
+
+	t.Run("should reject invalid requests", func(t *testing.T) {
+		conn := &fakeConn{reply: `{}`}
+		w := serve(conn, rule("GET", "/v1/groups/{id}"), httptest.NewRequest(http.MethodGet, "/v1/groups/g1?verbose=maybe", nil), "id", "g1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = serve(conn, rule("POST", "/v1/groups"), httptest.NewRequest(http.MethodPost, "/v1/groups", strings.NewReader(`{"size":"many"}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should reject bodies over the send limit", func(t *testing.T) {
+		conn := &fakeConn{reply: `{}`}
+		body := `{"name":"` + strings.Repeat("a", 64) + `"}`
+		w := serve(conn, rule("POST", "/v1/groups"), httptest.NewRequest(http.MethodPost, "/v1/groups", strings.NewReader(body)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Empty(t, conn.method)
+	})
+
+	t.Run("should map grpc errors", func(t *testing.T) {
+		conn := &fakeConn{err: status.Error(codes.Unavailable, "no backend")}
+		w := serve(conn, rule("GET", "/v1/groups/{id}"), httptest.NewRequest(http.MethodGet, "/v1/groups/g4", nil), "id", "g4")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		conn.err = status.Error(codes.NotFound, "no group")
+		w = serve(conn, rule("GET", "/v1/groups/{id}"), httptest.NewRequest(http.MethodGet, "/v1/groups/g4", nil), "id", "g4")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
@@ -2,12 +2,14 @@ package wrapper
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/zero-shubham/surveyx-apigw/client"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type Logger interface {
@@ -38,29 +40,65 @@ func NewWrapperClient(grpcClient client.AuthServiceClient, logger Logger) *wrapp
 	return &w
 }
 
+// httpStatusFromError picks the status answered for a failed grpc call.
+func httpStatusFromError(err error) int {
+	var tooLarge *MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	// requests over the send limit are rejected above, this is a response
+	// over the receive limit or a backend out of resources
+	case codes.ResourceExhausted:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Handlers maps the AuthService RPC names to the handler serving them, routes
+// in the config refer to handlers by these names.
+func (wc *wrapperClient) Handlers() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"UserToken":      wc.HandleUserToken,
+		"CreateUser":     wc.HandleCreateUser,
+		"CreateApp":      wc.HandleCreateApp,
+		"CreateAppGroup": wc.HandleCreateAppGroup,
+		"GetAppGroup":    wc.HandleGetAppGroup,
+		"UpdateAppGroup": wc.HandleUpdateAppGroup,
+	}
+}
+
 func (wc *wrapperClient) HandleUserToken(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
 	ctx := req.Context()
 
 	email := req.FormValue("email")
 	password := req.FormValue("password")
 
+	markPhase(ctx, phaseDecode)
 	for k, vals := range req.Header {
 		for _, v := range vals {
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
+	markPhase(ctx, phaseMetadata)
+
 	var respHeader metadata.MD
 	resp, err := wc.grpcClient.UserToken(ctx, &client.UserTokenRequest{
 		Email:    email,
 		Password: password,
 	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
 	if err != nil {
-		wc.logger.Error("error while making grpc call: ", err)
-		respWtr.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
 		return
 	}
 
-	wc.logger.Info("call to UserToken successful")
+	logger.Info("call to UserToken successful")
 
 	// Copy headers, status codes, and body from the backend to the response writer
 	for k, hs := range respHeader {
@@ -72,21 +110,23 @@ func (wc *wrapperClient) HandleUserToken(respWtr http.ResponseWriter, req *http.
 
 	respWtr.WriteHeader(http.StatusOK)
 	if resp == nil {
-		wc.logger.Warning("grpc response for UserToken is nil")
+		logger.Warning("grpc response for UserToken is nil")
 		return
 	}
 
 	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
 	if err != nil {
-		wc.logger.Error("error while marshaling resp: %v", err)
+		logger.Error("error while marshaling resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	wc.logger.Info("writing response body from UserToken")
+	logger.Info("writing response body from UserToken")
 
 	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while writing resp: %v", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -94,6 +134,7 @@ func (wc *wrapperClient) HandleUserToken(respWtr http.ResponseWriter, req *http.
 }
 
 func (wc *wrapperClient) HandleCreateUser(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
 	ctx := req.Context()
 
 	// Read and parse JSON request body
@@ -105,17 +146,20 @@ func (wc *wrapperClient) HandleCreateUser(respWtr http.ResponseWriter, req *http
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
-		wc.logger.Error("error while decoding request body: ", err)
+		logger.Error("error while decoding request body: ", err)
 		respWtr.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	markPhase(ctx, phaseDecode)
+
 	// Forward all headers to gRPC context
 	for k, vals := range req.Header {
 		for _, v := range vals {
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
+	markPhase(ctx, phaseMetadata)
 
 	var respHeader metadata.MD
 	resp, err := wc.grpcClient.CreateUser(ctx, &client.UserRequest{
@@ -124,13 +168,14 @@ func (wc *wrapperClient) HandleCreateUser(respWtr http.ResponseWriter, req *http
 		OrgId:      requestBody.OrgID,
 		AppGroupId: requestBody.AppGrpID,
 	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
 	if err != nil {
-		wc.logger.Error("error while making grpc call: ", err)
-		respWtr.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
 		return
 	}
 
-	wc.logger.Info("call to CreateUser successful")
+	logger.Info("call to CreateUser successful")
 
 	// Copy headers from the backend to the response writer
 	for k, hs := range respHeader {
@@ -142,27 +187,30 @@ func (wc *wrapperClient) HandleCreateUser(respWtr http.ResponseWriter, req *http
 
 	respWtr.WriteHeader(http.StatusOK)
 	if resp == nil {
-		wc.logger.Warning("grpc response for CreateUser is nil")
+		logger.Warning("grpc response for CreateUser is nil")
 		return
 	}
 
 	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
 	if err != nil {
-		wc.logger.Error("error while marshaling resp: %v", err)
+		logger.Error("error while marshaling resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	wc.logger.Info("writing response body from CreateUser")
+	logger.Info("writing response body from CreateUser")
 
 	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while writing resp: %v", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
 func (wc *wrapperClient) HandleCreateApp(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
 	ctx := req.Context()
 
 	// Read and parse JSON request body
@@ -172,30 +220,34 @@ func (wc *wrapperClient) HandleCreateApp(respWtr http.ResponseWriter, req *http.
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
-		wc.logger.Error("error while decoding request body: ", err)
+		logger.Error("error while decoding request body: ", err)
 		respWtr.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	markPhase(ctx, phaseDecode)
+
 	// Forward all headers to gRPC context
 	for k, vals := range req.Header {
 		for _, v := range vals {
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
+	markPhase(ctx, phaseMetadata)
 
 	var respHeader metadata.MD
 	resp, err := wc.grpcClient.CreateApp(ctx, &client.AppRequest{
 		AppGroupId: requestBody.AppGroupID,
 		OrgId:      requestBody.OrgID,
 	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
 	if err != nil {
-		wc.logger.Error("error while making grpc call: ", err)
-		respWtr.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
 		return
 	}
 
-	wc.logger.Info("call to CreateApp successful")
+	logger.Info("call to CreateApp successful")
 
 	// Copy headers from the backend to the response writer
 	for k, hs := range respHeader {
@@ -207,27 +259,30 @@ func (wc *wrapperClient) HandleCreateApp(respWtr http.ResponseWriter, req *http.
 
 	respWtr.WriteHeader(http.StatusOK)
 	if resp == nil {
-		wc.logger.Warning("grpc response for CreateApp is nil")
+		logger.Warning("grpc response for CreateApp is nil")
 		return
 	}
 
 	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
 	if err != nil {
-		wc.logger.Error("error while marshaling resp: %v", err)
+		logger.Error("error while marshaling resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	wc.logger.Info("writing response body from CreateApp")
+	logger.Info("writing response body from CreateApp")
 
 	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while writing resp: %v", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
 func (wc *wrapperClient) HandleCreateAppGroup(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
 	ctx := req.Context()
 
 	// Read and parse JSON request body
@@ -238,17 +293,20 @@ func (wc *wrapperClient) HandleCreateAppGroup(respWtr http.ResponseWriter, req *
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
-		wc.logger.Error("error while decoding request body: ", err)
+		logger.Error("error while decoding request body: ", err)
 		respWtr.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	markPhase(ctx, phaseDecode)
+
 	// Forward all headers to gRPC context
 	for k, vals := range req.Header {
 		for _, v := range vals {
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
+	markPhase(ctx, phaseMetadata)
 
 	var respHeader metadata.MD
 	resp, err := wc.grpcClient.CreateAppGroup(ctx, &client.AppGroupRequest{
@@ -256,13 +314,14 @@ func (wc *wrapperClient) HandleCreateAppGroup(respWtr http.ResponseWriter, req *
 		Scopes: requestBody.Scopes,
 		OrgId:  requestBody.OrgID,
 	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
 	if err != nil {
-		wc.logger.Error("error while making grpc call: ", err)
-		respWtr.WriteHeader(http.StatusInternalServerError)
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
 		return
 	}
 
-	wc.logger.Info("call to CreateAppGroup successful")
+	logger.Info("call to CreateAppGroup successful")
 
 	// Copy headers from the backend to the response writer
 	for k, hs := range respHeader {
@@ -274,37 +333,41 @@ func (wc *wrapperClient) HandleCreateAppGroup(respWtr http.ResponseWriter, req *
 
 	respWtr.WriteHeader(http.StatusOK)
 	if resp == nil {
-		wc.logger.Warning("grpc response for CreateAppGroup is nil")
+		logger.Warning("grpc response for CreateAppGroup is nil")
 		return
 	}
 
 	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
 	if err != nil {
-		wc.logger.Error("error while marshaling resp: %v", err)
+		logger.Error("error while marshaling resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	wc.logger.Info("writing response body from CreateAppGroup")
+	logger.Info("writing response body from CreateAppGroup")
 
 	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while writing resp: %v", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
 func (wc *wrapperClient) HandleGetAppGroup(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
 	ctx := req.Context()
 
 	// Get app group ID from path parameter
-	appGroupID := strings.TrimPrefix(req.URL.Path, "/app-groups/")
+	appGroupID := req.PathValue("id")
 	if appGroupID == "" {
-		wc.logger.Error("app_group_id is required in path")
+		logger.Error("app_group_id is required in path")
 		respWtr.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	appGroupID = strings.TrimSuffix(appGroupID, "/")
+
+	markPhase(ctx, phaseDecode)
 
 	// Forward all headers to gRPC context
 	for k, vals := range req.Header {
@@ -312,18 +375,126 @@ func (wc *wrapperClient) HandleGetAppGroup(respWtr http.ResponseWriter, req *htt
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
+	markPhase(ctx, phaseMetadata)
 
 	var respHeader metadata.MD
 	resp, err := wc.grpcClient.GetAppGroup(ctx, &client.GetAppGroupRequest{
 		Id: appGroupID,
 	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
+	if err != nil {
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
+		return
+	}
+
+	logger.Info("call to GetAppGroup successful")
+
+	// Copy headers from the backend to the response writer
+	for k, hs := range respHeader {
+		for _, h := range hs {
+			respWtr.Header().Add(k, h)
+		}
+	}
+	respWtr.Header().Add("Content-Type", "application/json")
+
+	if etag := ETag(resp); resp != nil && etag != "" {
+		respWtr.Header().Set("ETag", etag)
+		if etagMatches(req.Header.Get("If-None-Match"), etag, true) {
+			respWtr.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	respWtr.WriteHeader(http.StatusOK)
+	if resp == nil {
+		logger.Warning("grpc response for GetAppGroup is nil")
+		return
+	}
+
+	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
+	if err != nil {
+		logger.Error("error while marshaling resp: ", err)
+		respWtr.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.Info("writing response body from GetAppGroup")
+
+	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while making grpc call: ", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+}
+
+func (wc *wrapperClient) HandleUpdateAppGroup(respWtr http.ResponseWriter, req *http.Request) {
+	logger := RequestLogger(req.Context(), wc.logger)
+	ctx := req.Context()
+
+	// Get app group ID from path parameter
+	appGroupID := req.PathValue("id")
+	if appGroupID == "" {
+		logger.Error("app_group_id is required in path")
+		respWtr.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Read and parse JSON request body
+	var requestBody struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		OrgID  string   `json:"org_id"`
+	}
 
-	wc.logger.Info("call to GetAppGroup successful")
+	if err := json.NewDecoder(req.Body).Decode(&requestBody); err != nil {
+		logger.Error("error while decoding request body: ", err)
+		respWtr.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	markPhase(ctx, phaseDecode)
+
+	// Forward all headers to gRPC context
+	for k, vals := range req.Header {
+		for _, v := range vals {
+			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+		}
+	}
+	markPhase(ctx, phaseMetadata)
+
+	// Compare If-Match with the current state, the backend has no notion of versions
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		current, err := wc.grpcClient.GetAppGroup(ctx, &client.GetAppGroupRequest{Id: appGroupID})
+		if err != nil && status.Code(err) != codes.NotFound {
+			logger.Error("error while fetching current app group: ", err)
+			respWtr.WriteHeader(httpStatusFromError(err))
+			return
+		}
+		if err != nil || !etagMatches(ifMatch, ETag(current), false) {
+			logger.Warning("If-Match precondition failed for app group: ", appGroupID)
+			respWtr.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+	}
+
+	var respHeader metadata.MD
+	resp, err := wc.grpcClient.UpdateAppGroup(ctx, &client.AppGroupRequest{
+		Id:     appGroupID,
+		Name:   requestBody.Name,
+		Scopes: requestBody.Scopes,
+		OrgId:  requestBody.OrgID,
+	}, grpc.Header(&respHeader))
+	markPhase(ctx, phaseGRPC)
+	if err != nil {
+		logger.Error("error while making grpc call: ", err)
+		respWtr.WriteHeader(httpStatusFromError(err))
+		return
+	}
+
+	logger.Info("call to UpdateAppGroup successful")
 
 	// Copy headers from the backend to the response writer
 	for k, hs := range respHeader {
@@ -332,24 +503,29 @@ func (wc *wrapperClient) HandleGetAppGroup(respWtr http.ResponseWriter, req *htt
 		}
 	}
 	respWtr.Header().Add("Content-Type", "application/json")
+	if etag := ETag(resp); resp != nil && etag != "" {
+		respWtr.Header().Set("ETag", etag)
+	}
 
 	respWtr.WriteHeader(http.StatusOK)
 	if resp == nil {
-		wc.logger.Warning("grpc response for GetAppGroup is nil")
+		logger.Warning("grpc response for UpdateAppGroup is nil")
 		return
 	}
 
 	respBody, err := json.Marshal(resp)
+	markPhase(ctx, phaseMarshal)
 	if err != nil {
-		wc.logger.Error("error while marshaling resp: %v", err)
+		logger.Error("error while marshaling resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	wc.logger.Info("writing response body from GetAppGroup")
+	logger.Info("writing response body from UpdateAppGroup")
 
 	_, err = respWtr.Write(respBody)
+	markPhase(ctx, phaseWrite)
 	if err != nil {
-		wc.logger.Error("error while writing resp: %v", err)
+		logger.Error("error while writing resp: ", err)
 		respWtr.WriteHeader(http.StatusInternalServerError)
 		return
 	}
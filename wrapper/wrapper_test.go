@@ -14,6 +14,8 @@ import (
 	"github.com/zero-shubham/surveyx-apigw/mocks"
 	"github.com/zero-shubham/surveyx-apigw/wrapper"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestWrapper(t *testing.T) {
@@ -105,6 +107,46 @@ func TestWrapper(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
+	t.Run("oversize message should answer 413", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token", nil)
+		req.Form = map[string][]string{
+			"email":    {testEmail},
+			"password": {testPassword},
+		}
+
+		w := httptest.NewRecorder()
+
+		mockedClient.EXPECT().
+			UserToken(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, &wrapper.MessageTooLargeError{Size: 5000, Max: 4096})
+
+		mockedLogger.EXPECT().Error("error while making grpc call: ", gomock.Any())
+
+		mw.HandleUserToken(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("oversize response should answer 502", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token", nil)
+		req.Form = map[string][]string{
+			"email":    {testEmail},
+			"password": {testPassword},
+		}
+
+		w := httptest.NewRecorder()
+
+		mockedClient.EXPECT().
+			UserToken(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000 vs. 4096)"))
+
+		mockedLogger.EXPECT().Error("error while making grpc call: ", gomock.Any())
+
+		mw.HandleUserToken(w, req)
+
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+	})
+
 	t.Run("should be able to create user", func(t *testing.T) {
 		// Create test request body
 		requestBody := struct {
@@ -270,7 +312,8 @@ func TestWrapper(t *testing.T) {
 
 	t.Run("should be able to get app group", func(t *testing.T) {
 		// Create test request
-		req := httptest.NewRequest(http.MethodGet, "/app-groups/"+testAppGrpID, nil)
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/"+testAppGrpID, nil)
+		req.SetPathValue("id", testAppGrpID)
 
 		// Create response recorder
 		w := httptest.NewRecorder()
@@ -305,5 +348,101 @@ func TestWrapper(t *testing.T) {
 		assert.Equal(t, testAppGrpName, response.Name)
 		assert.Equal(t, testScopes, response.Scopes)
 		assert.Equal(t, testOrgID, response.OrgId)
+		assert.Equal(t, wrapper.ETag(expectedResp), w.Header().Get("ETag"))
+	})
+	t.Run("should answer 304 when the app group is not modified", func(t *testing.T) {
+		current := &client.AppGroupResponse{Id: testAppGrpID, Name: testAppGrpName}
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/app-groups/"+testAppGrpID, nil)
+		req.SetPathValue("id", testAppGrpID)
+		req.Header.Set("If-None-Match", `"stale", W/`+wrapper.ETag(current))
+		w := httptest.NewRecorder()
+
+		mockedClient.EXPECT().GetAppGroup(gomock.Any(), gomock.Any(), gomock.Any()).Return(current, nil)
+		mockedLogger.EXPECT().Info("call to GetAppGroup successful")
+
+		mw.HandleGetAppGroup(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, wrapper.ETag(current), w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+	})
+	t.Run("should reject an update when If-Match does not match", func(t *testing.T) {
+		current := &client.AppGroupResponse{Id: testAppGrpID, Name: "renamed"}
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/app-groups/"+testAppGrpID, bytes.NewReader([]byte(`{"name":"new"}`)))
+		req.SetPathValue("id", testAppGrpID)
+		req.Header.Set("If-Match", wrapper.ETag(&client.AppGroupResponse{Id: testAppGrpID, Name: testAppGrpName}))
+		w := httptest.NewRecorder()
+
+		mockedClient.EXPECT().
+			GetAppGroup(gomock.Any(), &client.GetAppGroupRequest{Id: testAppGrpID}).
+			Return(current, nil)
+		mockedLogger.EXPECT().Warning("If-Match precondition failed for app group: ", testAppGrpID)
+
+		mw.HandleUpdateAppGroup(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+	t.Run("should reject a request without an app group id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mockedLogger.EXPECT().Error("app_group_id is required in path")
+
+		mw.HandleGetAppGroup(w, httptest.NewRequest(http.MethodGet, "/v1/app-groups", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("should be able to update app group", func(t *testing.T) {
+		// Create test request body
+		requestBody := struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+			OrgID  string   `json:"org_id"`
+		}{
+			Name:   testAppGrpName,
+			Scopes: testScopes,
+			OrgID:  testOrgID,
+		}
+		body, err := json.Marshal(requestBody)
+		assert.NoError(t, err)
+
+		// Create test request
+		req := httptest.NewRequest(http.MethodPut, "/v1/app-groups/"+testAppGrpID, bytes.NewReader(body))
+		req.SetPathValue("id", testAppGrpID)
+
+		// Create response recorder
+		w := httptest.NewRecorder()
+
+		// Setup mock expectations
+		expectedResp := &client.AppGroupResponse{
+			Id:     testAppGrpID,
+			Name:   testAppGrpName,
+			Scopes: testScopes,
+			OrgId:  testOrgID,
+		}
+
+		mockedClient.EXPECT().
+			UpdateAppGroup(gomock.Any(), &client.AppGroupRequest{
+				Id:     testAppGrpID,
+				Name:   testAppGrpName,
+				Scopes: testScopes,
+				OrgId:  testOrgID,
+			}, gomock.Any()).
+			Return(expectedResp, nil)
+
+		mockedLogger.EXPECT().Info("call to UpdateAppGroup successful")
+		mockedLogger.EXPECT().Info("writing response body from UpdateAppGroup")
+
+		// Call the handler
+		mw.HandleUpdateAppGroup(w, req)
+
+		// Assert response
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response client.AppGroupResponse
+		err = json.NewDecoder(w.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, testAppGrpID, response.Id)
+		assert.Equal(t, testAppGrpName, response.Name)
 	})
 }